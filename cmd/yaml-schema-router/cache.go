@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/detector/kubernetes"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const (
+	// defaultPruneAge is how long a generated schema may go unused before
+	// "cache prune" removes it.
+	defaultPruneAge = 30 * 24 * time.Hour
+
+	// timeLayout formats times in command output.
+	timeLayout = "2006-01-02 15:04"
+
+	tabPadding = 2
+)
+
+const cacheUsage = `usage: yaml-schema-router cache COMMAND [flags]
+
+Commands:
+  list [PREFIX]      List the cached schemas, optionally below a cache path.
+  info               Summarize the cache and the schemas that failed to download.
+  prune              Remove generated schemas that are unused or broken.
+  clear [PREFIX]     Remove the whole cache, or a cache path.
+  prefetch [DIR...]  Download the schemas of a Kubernetes version or of the
+                     manifests below directories.`
+
+// skippedDirs are directories walkYAMLFiles doesn't descend into.
+var skippedDirs = map[string]bool{"node_modules": true, "vendor": true}
+
+// runCache implements "yaml-schema-router cache", which inspects and
+// maintains the schema cache.
+func runCache(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New(cacheUsage)
+	}
+
+	commands := map[string]func(context.Context, []string) error{
+		"list":     runCacheList,
+		"info":     runCacheInfo,
+		"prune":    runCachePrune,
+		"clear":    runCacheClear,
+		"prefetch": runCachePrefetch,
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q\n%s", args[0], cacheUsage)
+	}
+
+	return command(ctx, args[1:])
+}
+
+func runCacheList(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("cache list", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	entries, err := registry.Entries()
+	if err != nil {
+		return err
+	}
+
+	prefix := filepath.Clean(flags.Arg(0))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, tabPadding, ' ', 0)
+	fmt.Fprintln(w, "PATH\tSIZE\tUPDATED\tSOURCE")
+	for _, entry := range entries {
+		if flags.NArg() > 0 && !underPrefix(entry.Path, prefix) {
+			continue
+		}
+
+		updated, source := entry.ModTime.Format(timeLayout), "generated"
+		switch {
+		case entry.Pack != "":
+			updated, source = "-", "schema pack "+entry.Pack
+		case !entry.Generated:
+			updated, source = entry.FetchedAt.Format(timeLayout), entry.SourceURL
+			if entry.Stale(cfg.Registry.MaxAge) {
+				updated += " (stale)"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", filepath.ToSlash(entry.Path), formatSize(entry.Size), updated, source)
+	}
+
+	return w.Flush()
+}
+
+// cacheDirStats sums up the schemas below a top-level cache directory.
+type cacheDirStats struct {
+	Downloaded, Generated, Stale, FromPack int
+	Size                                   int64
+}
+
+func runCacheInfo(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("cache info", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	entries, err := registry.Entries()
+	if err != nil {
+		return err
+	}
+
+	var total cacheDirStats
+	dirs := make(map[string]*cacheDirStats)
+	for _, entry := range entries {
+		dir, _, _ := strings.Cut(filepath.ToSlash(entry.Path), "/")
+		if dirs[dir] == nil {
+			dirs[dir] = &cacheDirStats{}
+		}
+		for _, stats := range []*cacheDirStats{dirs[dir], &total} {
+			stats.add(entry, cfg.Registry.MaxAge)
+		}
+	}
+
+	fmt.Printf("Cache directory: %s\n", registry.Dir())
+	fmt.Printf("Downloaded schemas: %d (%d stale, %d from schema packs)\n", total.Downloaded, total.Stale, total.FromPack)
+	fmt.Printf("Generated schemas: %d\n", total.Generated)
+	fmt.Printf("Total size: %s\n\n", formatSize(total.Size))
+
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, tabPadding, ' ', 0)
+	fmt.Fprintln(w, "DIRECTORY\tDOWNLOADED\tGENERATED\tSIZE")
+	for _, name := range names {
+		stats := dirs[name]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", name, stats.Downloaded, stats.Generated, formatSize(stats.Size))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return printUnavailable(os.Stdout, registry.UnavailableSchemas())
+}
+
+func (s *cacheDirStats) add(entry schemaregistry.CacheEntry, maxAge time.Duration) {
+	s.Size += entry.Size
+	switch {
+	case entry.Generated:
+		s.Generated++
+	case entry.Pack != "":
+		s.Downloaded++
+		s.FromPack++
+	default:
+		s.Downloaded++
+		if entry.Stale(maxAge) {
+			s.Stale++
+		}
+	}
+}
+
+// printUnavailable lists the schemas whose downloads are backing off.
+func printUnavailable(w io.Writer, unavailable []schemaregistry.UnavailableSchema) error {
+	if len(unavailable) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "\nUnavailable schemas: %d\n", len(unavailable))
+	for _, schema := range unavailable {
+		_, err := fmt.Fprintf(w, "  %s\n    %s, retrying after %s\n",
+			schema.URL, schema.Reason, schema.RetryAt.Format(timeLayout))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCachePrune(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("cache prune", flag.ContinueOnError)
+	olderThan := flags.Duration("older-than", defaultPruneAge,
+		"Remove generated schemas that were not used for this long, e.g. 168h.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	_, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	result, err := registry.Prune(*olderThan)
+	for _, path := range result.Removed {
+		fmt.Println(filepath.ToSlash(path))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Removed %d schemas, freed %s\n", len(result.Removed), formatSize(result.Freed))
+	return nil
+}
+
+func runCacheClear(_ context.Context, args []string) error {
+	flags := flag.NewFlagSet("cache clear", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return errors.New("usage: yaml-schema-router cache clear [PREFIX]")
+	}
+
+	_, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if err := registry.Clear(flags.Arg(0)); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Fprintf(os.Stderr, "Cleared %s\n", registry.Dir())
+	} else {
+		fmt.Fprintf(os.Stderr, "Cleared %s\n", flags.Arg(0))
+	}
+	return nil
+}
+
+func runCachePrefetch(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("cache prefetch", flag.ContinueOnError)
+	flavour := flags.String("flavour", "",
+		"Schema flavour of the Kubernetes versions. Defaults to the configured flavour.")
+	var versions stringList
+	flags.Var(&versions, "kubernetes-version",
+		"Kubernetes version whose built-in schemas are downloaded. Repeatable. "+
+			"Defaults to the configured version unless directories are given.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	if *flavour == "" {
+		*flavour = cfg.Kubernetes.Flavour
+	}
+	if len(versions) == 0 && flags.NArg() == 0 {
+		versions = append(versions, cfg.Kubernetes.Version)
+	}
+
+	for _, version := range versions {
+		fmt.Fprintf(os.Stderr, "Downloading the %s schemas of Kubernetes %s ...\n", *flavour, version)
+
+		uris, err := kubernetes.PrefetchBuiltin(ctx, registry, cfg, version, *flavour)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Cached %d built-in schemas of Kubernetes %s\n", len(uris), version)
+	}
+
+	chain := newDetectorChain(registry, cfg)
+	for _, dir := range flags.Args() {
+		if err := prefetchDir(ctx, chain, dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// prefetchDir runs the detectors on every YAML file below dir, which
+// downloads and generates the schemas they route to.
+func prefetchDir(ctx context.Context, chain *detector.Chain, dir string) error {
+	var manifests, routed int
+
+	err := walkYAMLFiles(dir, func(path string) error {
+		matches, err := detectFile(ctx, chain, path)
+		if err != nil {
+			return err
+		}
+		manifests++
+		if len(matches) > 0 {
+			routed++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Cached the schemas of %d of %d YAML files below %s\n", routed, manifests, dir)
+	return nil
+}
+
+// walkYAMLFiles calls fn with every .yaml and .yml file below root, skipping
+// hidden directories and dependency directories such as node_modules. A root
+// that is a file is passed to fn whatever its extension.
+func walkYAMLFiles(root string, fn func(path string) error) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(entry.Name(), ".") || skippedDirs[entry.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); path != root && ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+
+		return fn(path)
+	})
+}
+
+// detectFile runs the detectors on the file at path.
+func detectFile(ctx context.Context, chain *detector.Chain, path string) ([]detector.Match, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // the path is given on the command line
+	if err != nil {
+		return nil, err
+	}
+
+	uri, err := fileuri.FromPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return chain.Run(ctx, uri, data)
+}
+
+// underPrefix reports whether the cache path is prefix or below it.
+func underPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+string(filepath.Separator))
+}
+
+// formatSize formats a byte count with a binary unit.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+// loadCommandEnvironment loads the configuration for the current directory
+// and opens the schema cache, for subcommands run from a terminal.
+func loadCommandEnvironment() (*config.Config, *schemaregistry.Registry, func(), error) {
+	workspaceRoot, err := os.Getwd()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cfg, err := config.NewLoader(nil).Load(workspaceRoot)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	closeLog, err := setupLogging(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	registry, err := schemaregistry.NewRegistry(cfg)
+	if err != nil {
+		closeLog()
+		return nil, nil, nil, fmt.Errorf("failed to initialize schema registry: %w", err)
+	}
+
+	return cfg, registry, closeLog, nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/detector/kubernetes"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+	"go.trai.ch/yaml-schema-router/internal/yamldoc"
+)
+
+// Output formats of the detect command.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// Cache statuses of a detected schema.
+const (
+	cacheHit      = "hit"
+	cacheMiss     = "miss"
+	cacheExternal = "external"
+)
+
+// detectReport explains how the router routes one file.
+type detectReport struct {
+	File string `json:"file"`
+	URI  string `json:"uri,omitempty"`
+
+	// Annotation is the schema of a manual schema annotation, which makes the
+	// router leave the file alone.
+	Annotation string `json:"annotation,omitempty"`
+
+	Documents []detectDocument `json:"documents,omitempty"`
+
+	// Composite is the schema the language server is configured with.
+	Composite string `json:"composite,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// detectDocument is a YAML document of a file and the schemas detected for it.
+type detectDocument struct {
+	StartLine  int            `json:"startLine"`
+	EndLine    int            `json:"endLine"`
+	APIVersion string         `json:"apiVersion,omitempty"`
+	Kind       string         `json:"kind,omitempty"`
+	Schemas    []detectSchema `json:"schemas"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// detectSchema is a schema a detector claimed, or one a generated schema
+// references.
+type detectSchema struct {
+	Detector string `json:"detector,omitempty"`
+	LocalURI string `json:"localURI"`
+
+	// Cache is hit if the schema was cached before detection, miss if
+	// detection downloaded or generated it, and external for files outside
+	// the cache.
+	Cache     string `json:"cache"`
+	Generated bool   `json:"generated,omitempty"`
+	Stale     bool   `json:"stale,omitempty"`
+
+	SourceURL string `json:"sourceURL,omitempty"`
+	FetchedAt string `json:"fetchedAt,omitempty"`
+	Pack      string `json:"pack,omitempty"`
+
+	References []detectSchema `json:"references,omitempty"`
+}
+
+// runDetect implements "yaml-schema-router detect", which explains the
+// routing decisions for files the way the proxy makes them.
+func runDetect(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("detect", flag.ContinueOnError)
+	format := flags.String("format", formatText, "Output format: text or json.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return errors.New("usage: yaml-schema-router detect [--format text|json] FILE...")
+	}
+	if *format != formatText && *format != formatJSON {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	cfg, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	chain := newDetectorChain(registry, cfg)
+	reports := make([]detectReport, 0, flags.NArg())
+	failed := 0
+	for _, path := range flags.Args() {
+		report := detectFileReport(ctx, chain, registry, cfg.Registry.MaxAge, path)
+		if report.Error != "" {
+			failed++
+		}
+		reports = append(reports, report)
+	}
+
+	if *format == formatJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(reports)
+	} else {
+		err = printDetectReports(os.Stdout, reports)
+	}
+	if err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files could not be detected", failed, len(reports))
+	}
+	return nil
+}
+
+// detectFileReport runs the detectors on a file and resolves the composite
+// schema like the proxy does for an open document.
+func detectFileReport(
+	ctx context.Context,
+	chain *detector.Chain,
+	registry *schemaregistry.Registry,
+	maxAge time.Duration,
+	path string,
+) detectReport {
+	report := detectReport{File: path}
+
+	content, err := os.ReadFile(path) //nolint:gosec // the path is given on the command line
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if report.URI, err = fileuri.FromPath(path); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if schema, annotated := detector.SchemaAnnotation(content); annotated {
+		report.Annotation = schema
+		return report
+	}
+
+	cached := cachedPaths(registry)
+	matches, err := chain.Run(ctx, report.URI, content)
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+
+	describe := schemaDescriber{registry: registry, cached: cached, maxAge: maxAge}
+	for _, doc := range yamldoc.Split(content) {
+		document := detectDocument{StartLine: doc.StartLine, EndLine: doc.EndLine, Schemas: []detectSchema{}}
+		if doc.Err != nil {
+			document.Error = doc.Err.Error()
+		}
+		document.APIVersion, document.Kind = kubernetes.TypeMeta(doc)
+
+		for _, match := range matches {
+			if match.StartLine == 0 || match.StartLine == doc.StartLine {
+				schema := describe.schema(match.SchemaURI)
+				schema.Detector = match.Detector
+				document.Schemas = append(document.Schemas, schema)
+			}
+		}
+		report.Documents = append(report.Documents, document)
+	}
+
+	if len(matches) > 0 {
+		members := make([]schemaregistry.CompositeMember, 0, len(matches))
+		for _, m := range matches {
+			members = append(members, schemaregistry.CompositeMember{
+				URI: m.SchemaURI, Discriminator: m.Discriminator, StartLine: m.StartLine,
+			})
+		}
+		if report.Composite, err = registry.GenerateCompositeSchema(members, len(report.Documents)); err != nil {
+			report.Error = err.Error()
+		}
+	}
+
+	return report
+}
+
+// cachedPaths returns the cache paths of the schemas in the cache.
+func cachedPaths(registry *schemaregistry.Registry) map[string]bool {
+	entries, _ := registry.Entries()
+
+	paths := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		paths[entry.Path] = true
+	}
+	return paths
+}
+
+// schemaDescriber looks up detected schemas in the cache.
+type schemaDescriber struct {
+	registry *schemaregistry.Registry
+	cached   map[string]bool
+	maxAge   time.Duration
+}
+
+// schema describes the schema at localURI and, for generated schemas, the
+// schemas it references.
+func (d schemaDescriber) schema(localURI string) detectSchema {
+	schema := detectSchema{LocalURI: localURI, Cache: cacheExternal}
+
+	entry, ok := d.registry.Entry(localURI)
+	if !ok {
+		return schema
+	}
+
+	schema.Cache = cacheMiss
+	if d.cached[entry.Path] {
+		schema.Cache = cacheHit
+	}
+	schema.Generated, schema.Stale = entry.Generated, entry.Stale(d.maxAge)
+	schema.SourceURL, schema.Pack = entry.SourceURL, entry.Pack
+	if !entry.FetchedAt.IsZero() {
+		schema.FetchedAt = entry.FetchedAt.Format(time.RFC3339)
+	}
+
+	if entry.Generated {
+		for _, ref := range d.registry.References(localURI) {
+			schema.References = append(schema.References, d.schema(ref))
+		}
+	}
+
+	return schema
+}
+
+func printDetectReports(w io.Writer, reports []detectReport) error {
+	var b strings.Builder
+
+	for i, report := range reports {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s\n", report.File)
+
+		switch {
+		case report.Error != "":
+			fmt.Fprintf(&b, "  error: %s\n", report.Error)
+		case report.Annotation != "":
+			fmt.Fprintf(&b, "  manual schema annotation: %s\n  the router leaves this file to the language server\n",
+				report.Annotation)
+		case len(report.Documents) == 0:
+			b.WriteString("  no YAML documents\n")
+		}
+
+		for _, doc := range report.Documents {
+			writeDetectDocument(&b, doc)
+		}
+		if report.Composite != "" {
+			fmt.Fprintf(&b, "  schema: %s\n", report.Composite)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeDetectDocument(b *strings.Builder, doc detectDocument) {
+	fmt.Fprintf(b, "  lines %d-%d", doc.StartLine, doc.EndLine)
+	if typeMeta := strings.TrimSpace(doc.APIVersion + " " + doc.Kind); typeMeta != "" {
+		fmt.Fprintf(b, ": %s", typeMeta)
+	}
+	b.WriteString("\n")
+
+	if doc.Error != "" {
+		fmt.Fprintf(b, "    syntax error: %s\n", doc.Error)
+	}
+	if len(doc.Schemas) == 0 {
+		b.WriteString("    no schema detected\n")
+	}
+	for _, schema := range doc.Schemas {
+		writeDetectSchema(b, schema, "    ")
+	}
+}
+
+func writeDetectSchema(b *strings.Builder, schema detectSchema, indent string) {
+	label := "references"
+	if schema.Detector != "" {
+		label = schema.Detector
+	}
+	fmt.Fprintf(b, "%s%s: %s\n", indent, label, schema.LocalURI)
+
+	var status string
+	switch {
+	case schema.Cache == cacheExternal:
+		status = "outside the cache"
+	case schema.Generated:
+		status = "generated, cache " + schema.Cache
+	case schema.Pack != "":
+		status = fmt.Sprintf("from schema pack %s, cache %s", schema.Pack, schema.Cache)
+	default:
+		status = fmt.Sprintf("downloaded %s, cache %s", schema.FetchedAt, schema.Cache)
+	}
+	if schema.Stale {
+		status += ", stale"
+	}
+	fmt.Fprintf(b, "%s  %s\n", indent, status)
+	if schema.SourceURL != "" {
+		fmt.Fprintf(b, "%s  source: %s\n", indent, schema.SourceURL)
+	}
+
+	for _, ref := range schema.References {
+		writeDetectSchema(b, ref, indent+"  ")
+	}
+}
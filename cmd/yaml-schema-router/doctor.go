@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/cluster"
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/detector/kubernetes"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/lspproxy"
+	"go.trai.ch/yaml-schema-router/internal/schemapack"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const (
+	// minLSPVersion and recommendedLSPVersion are the yaml-language-server
+	// releases listed under Compatibility in the README.
+	minLSPVersion         = "1.0.0"
+	recommendedLSPVersion = "1.10.0"
+
+	// lspPackageName is the npm package yaml-language-server is published as.
+	lspPackageName = "yaml-language-server"
+
+	// handshakeTimeout is how long the language server may take to answer
+	// initialize. Node.js servers take a moment to start.
+	handshakeTimeout = 15 * time.Second
+)
+
+// Statuses of doctor checks.
+const (
+	statusOK   = "ok"
+	statusWarn = "warn"
+	statusFail = "FAIL"
+)
+
+// doctor prints the outcome of checks and counts the problems.
+type doctor struct {
+	out      io.Writer
+	warnings int
+	failures int
+}
+
+// runDoctor implements "yaml-schema-router doctor", which diagnoses the
+// usual reasons for the router doing nothing: a missing or old language
+// server, unreachable schema sources and an unwritable cache. It takes the
+// flags the editor passes to the proxy.
+func runDoctor(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: yaml-schema-router doctor [PROXY FLAGS]")
+		flags.PrintDefaults()
+	}
+	loader, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+
+	// Like the proxy, the project configuration of the working directory may
+	// not choose the language server, log file or cluster
+	workspaceRoot, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	cfg, settings, err := loader.Explain(workspaceRoot)
+	if err != nil {
+		return err
+	}
+
+	d := &doctor{out: os.Stdout}
+
+	fmt.Fprintln(d.out, "Checks:")
+	closeLog := d.checkLogging(cfg)
+	defer closeLog()
+	d.checkLSP(ctx, cfg)
+	d.checkCache()
+	d.checkSources(ctx, cfg)
+
+	fmt.Fprintln(d.out)
+	printConfigFiles(d.out)
+	fmt.Fprintln(d.out)
+	if err := printSettings(d.out, settings); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(d.out)
+	if d.failures > 0 {
+		return fmt.Errorf("%d checks failed, %d warnings", d.failures, d.warnings)
+	}
+	fmt.Fprintf(d.out, "No problems found, %d warnings.\n", d.warnings)
+	return nil
+}
+
+// report prints the outcome of a check. Continuation lines of the message
+// are indented below it.
+func (d *doctor) report(status, format string, args ...any) {
+	switch status {
+	case statusWarn:
+		d.warnings++
+	case statusFail:
+		d.failures++
+	}
+
+	msg := strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", "\n         ")
+	fmt.Fprintf(d.out, "  [%-4s] %s\n", status, msg)
+}
+
+// checkLogging sets up logging like the proxy does, which fails the proxy
+// at startup if the log file can't be written. It returns the function
+// closing the log file.
+func (d *doctor) checkLogging(cfg *config.Config) func() {
+	closeLog, err := setupLogging(cfg)
+	switch {
+	case err != nil:
+		d.report(statusFail, "Logging: %v", err)
+		return func() {}
+	case cfg.LogLevel == config.LogLevelOff:
+		d.report(statusOK, "Logging is off")
+	case cfg.LogFile == "":
+		d.report(statusOK, "Logging to stderr")
+	default:
+		d.report(statusOK, "Logging to %s", cfg.LogFile)
+	}
+	return closeLog
+}
+
+// checkLSP looks up the language server, performs an initialize handshake
+// with it and checks its version.
+func (d *doctor) checkLSP(ctx context.Context, cfg *config.Config) {
+	executable, err := exec.LookPath(cfg.LSPPath)
+	if err != nil {
+		d.report(statusFail, "Language server %q not found: %v\n"+
+			"Install it with \"npm install -g yaml-language-server\" or set --lsp-path.", cfg.LSPPath, err)
+		return
+	}
+	d.report(statusOK, "Language server executable: %s", executable)
+
+	rootURI, err := fileuri.FromPath(cfg.WorkspaceRoot)
+	if err != nil {
+		d.report(statusFail, "Language server handshake: %v", err)
+		return
+	}
+
+	handshakeCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+
+	start := time.Now()
+	info, err := lspproxy.Handshake(handshakeCtx, cfg, rootURI)
+	switch {
+	case err != nil:
+		d.report(statusFail, "Language server handshake with %s %s: %v",
+			cfg.LSPPath, strings.Join(cfg.LSPArgs, " "), err)
+	case !info.TextDocumentSync:
+		d.report(statusWarn, "Language server answered initialize in %s but doesn't synchronize documents",
+			time.Since(start).Round(time.Millisecond))
+	default:
+		d.report(statusOK, "Language server answered initialize in %s", time.Since(start).Round(time.Millisecond))
+	}
+
+	version := lspPackageVersion(executable)
+	if version == "" && info != nil {
+		version = info.Version
+	}
+	d.checkLSPVersion(version)
+}
+
+func (d *doctor) checkLSPVersion(version string) {
+	switch {
+	case version == "":
+		d.report(statusWarn, "Could not determine the yaml-language-server version")
+	case compareVersions(version, minLSPVersion) < 0:
+		d.report(statusFail, "yaml-language-server %s is older than %s\n"+
+			"Update it with \"npm install -g yaml-language-server@latest\".", version, minLSPVersion)
+	case compareVersions(version, recommendedLSPVersion) < 0:
+		d.report(statusWarn, "yaml-language-server %s is older than the recommended %s", version, recommendedLSPVersion)
+	default:
+		d.report(statusOK, "yaml-language-server %s", version)
+	}
+}
+
+// lspPackageVersion returns the version in the package.json of the npm
+// package the executable belongs to, or "" if there is none.
+func lspPackageVersion(executable string) string {
+	resolved, err := filepath.EvalSymlinks(executable)
+	if err != nil {
+		return ""
+	}
+
+	for dir := filepath.Dir(resolved); ; dir = filepath.Dir(dir) {
+		data, err := os.ReadFile(filepath.Join(dir, "package.json")) //nolint:gosec // next to the configured executable
+		if err == nil {
+			var pkg struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			}
+			if json.Unmarshal(data, &pkg) == nil && pkg.Name == lspPackageName {
+				return pkg.Version
+			}
+		}
+
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// compareVersions compares two "major.minor.patch" versions, ignoring a "v"
+// prefix and pre-release or build suffixes.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := range pa {
+		if pa[i] != pb[i] {
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) [3]int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+
+	var parts [3]int
+	for i, field := range strings.SplitN(version, ".", len(parts)) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts
+}
+
+// checkCache verifies that schemas can be written to every directory of the
+// cache. Directories created by another user, e.g. when the router once ran
+// through sudo, make downloads fail.
+func (d *doctor) checkCache() {
+	dir, err := schemaregistry.CacheDir()
+	if err != nil {
+		d.report(statusFail, "Schema cache: %v", err)
+		return
+	}
+	if err := os.MkdirAll(dir, config.DefaultDirPerm); err != nil {
+		d.report(statusFail, "Schema cache %s can't be created: %v", dir, err)
+		return
+	}
+
+	var unwritable []string
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			unwritable = append(unwritable, path)
+			return nil
+		}
+		if entry.IsDir() && !writable(path) {
+			unwritable = append(unwritable, path)
+		}
+		return nil
+	})
+
+	if len(unwritable) > 0 {
+		d.report(statusFail, "Schema cache %s has %d directories that can't be written, e.g. %s\n"+
+			"Fix their ownership or remove them.", dir, len(unwritable), unwritable[0])
+		return
+	}
+	d.report(statusOK, "Schema cache %s is writable", dir)
+}
+
+// writable reports whether a file can be created in dir.
+func writable(dir string) bool {
+	f, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+	return true
+}
+
+// checkSources probes the schema registries and mirrors, the schema packs,
+// the local CRD directories and the cluster.
+func (d *doctor) checkSources(ctx context.Context, cfg *config.Config) {
+	for _, probe := range kubernetes.ProbeSources(ctx, cfg) {
+		d.checkCatalog(probe)
+	}
+
+	for _, path := range cfg.Registry.Packs {
+		path = resolveWorkspacePath(cfg, path)
+		names, err := schemapack.Open(path).Names()
+		if err != nil {
+			d.report(statusFail, "Schema pack: %v", err)
+			continue
+		}
+		d.report(statusOK, "Schema pack %s holds %d schemas", path, len(names))
+	}
+	if names, err := schemapack.Embedded().Names(); err == nil {
+		d.report(statusOK, "Embedded schema pack holds %d schemas", len(names))
+	}
+
+	for _, dir := range cfg.CRD.LocalDirs {
+		dir = resolveWorkspacePath(cfg, dir)
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			d.report(statusWarn, "CRD directory %s does not exist", dir)
+			continue
+		}
+		d.report(statusOK, "CRD directory %s exists", dir)
+	}
+
+	if cfg.Cluster.Enabled {
+		contextName, groupVersions, err := cluster.NewSource(nil, cfg).Probe(ctx)
+		label := strings.TrimSpace("Cluster " + contextName)
+		if err != nil {
+			d.report(statusFail, "%s: %v", label, err)
+		} else {
+			d.report(statusOK, "%s serves %d group versions", label, groupVersions)
+		}
+	}
+}
+
+// checkCatalog reports the sources of a catalog. A failing mirror is only a
+// warning while another source serves the schema, as the router falls back
+// to it.
+func (d *doctor) checkCatalog(probe kubernetes.CatalogProbe) {
+	if len(probe.Sources) == 0 {
+		d.report(statusWarn, "%s has no schema source configured", probe.Catalog)
+		return
+	}
+
+	served := false
+	for _, source := range probe.Sources {
+		served = served || source.Err == nil
+	}
+
+	for _, source := range probe.Sources {
+		switch {
+		case source.Err == nil:
+			d.report(statusOK, "%s source %s served the %s schema in %s",
+				probe.Catalog, source.Source, probe.Schema, source.Duration.Round(time.Millisecond))
+		case source.Missing:
+			d.report(statusWarn, "%s source %s is reachable but has no %s schema",
+				probe.Catalog, source.Source, probe.Schema)
+		case served:
+			d.report(statusWarn, "%s source %s: %v", probe.Catalog, source.Source, source.Err)
+		default:
+			d.report(statusFail, "%s source %s: %v", probe.Catalog, source.Source, source.Err)
+		}
+	}
+}
+
+// resolveWorkspacePath resolves a relative path against the workspace root,
+// like the registry and the detectors do.
+func resolveWorkspacePath(cfg *config.Config, path string) string {
+	if filepath.IsAbs(path) || cfg.WorkspaceRoot == "" {
+		return path
+	}
+	return filepath.Join(cfg.WorkspaceRoot, path)
+}
+
+// printSettings prints the effective configuration with the layer each
+// setting was taken from.
+func printSettings(w io.Writer, settings []config.Setting) error {
+	fmt.Fprintln(w, "Effective configuration:")
+
+	tw := tabwriter.NewWriter(w, 0, 0, tabPadding, ' ', 0)
+	for _, setting := range settings {
+		value := setting.Value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", setting.Key, value, setting.Source)
+	}
+	return tw.Flush()
+}
+
+// printConfigFiles lists the configuration files that are read, so a
+// misnamed or misplaced file stands out.
+func printConfigFiles(w io.Writer) {
+	var files []string
+	if dir, err := config.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, config.UserConfigFileName))
+	}
+	if wd, err := os.Getwd(); err == nil {
+		files = append(files, filepath.Join(wd, config.ProjectConfigFileName))
+	}
+
+	fmt.Fprintln(w, "Configuration files:")
+	for _, file := range files {
+		_, err := os.Stat(file)
+		switch {
+		case err == nil:
+			fmt.Fprintf(w, "  %s\n", file)
+		case errors.Is(err, fs.ErrNotExist):
+			fmt.Fprintf(w, "  %s (not found)\n", file)
+		default:
+			fmt.Fprintf(w, "  %s (%v)\n", file, err)
+		}
+	}
+}
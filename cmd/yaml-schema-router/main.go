@@ -3,14 +3,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 
+	"go.trai.ch/yaml-schema-router/internal/cluster"
 	"go.trai.ch/yaml-schema-router/internal/config"
 	"go.trai.ch/yaml-schema-router/internal/detector"
 	"go.trai.ch/yaml-schema-router/internal/detector/kubernetes"
@@ -20,81 +24,199 @@ import (
 
 const componentName = "Main"
 
+// subcommands are run instead of the proxy when their name is the first
+// argument. Editors only ever pass flags.
+var subcommands = map[string]func(ctx context.Context, args []string) error{
+	"cache":    runCache,
+	"detect":   runDetect,
+	"doctor":   runDoctor,
+	"pack":     runPack,
+	"validate": runValidate,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if subcommand, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(runSubcommand(os.Args[1], subcommand))
+		}
+	}
+
 	if err := run(); err != nil {
 		log.Fatalf("[%s] Fatal error: %v", componentName, err)
 	}
 }
 
+// runSubcommand runs a subcommand and returns its exit code. Errors are
+// printed to stderr, since logs go to the log file.
+func runSubcommand(name string, subcommand func(ctx context.Context, args []string) error) int {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if err := subcommand(ctx, os.Args[2:]); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "yaml-schema-router %s: %v\n", name, err)
+		}
+		return 1
+	}
+	return 0
+}
+
 func run() error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	defaultLogPath := ""
-	homeDir, homeErr := os.UserHomeDir()
-	if homeErr == nil {
-		defaultLogPath = filepath.Join(homeDir, ".config", config.DefaultConfigDirName, "router.log")
-	} else {
-		defaultLogPath = filepath.Join(os.TempDir(), "yaml-schema-router.log")
+	loader, err := parseFlags(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loader.Load("")
+	if err != nil {
+		return err
+	}
+
+	closeLog, err := setupLogging(cfg)
+	if err != nil {
+		return err
 	}
+	defer closeLog()
 
-	logFile := flag.String(
+	log.Printf("[%s] Starting yaml-schema-router. Using LSP executable: %s", componentName, cfg.LSPPath)
+
+	proxy, err := lspproxy.NewProxy(cfg, loader, newProxyComponents)
+	if err != nil {
+		return err
+	}
+
+	if err := proxy.Start(ctx); err != nil {
+		return err
+	}
+
+	log.Printf("[%s] Proxy shut down cleanly.", componentName)
+
+	return nil
+}
+
+// newProxyComponents builds the schema registry and detector chain the proxy
+// routes documents with.
+func newProxyComponents(cfg *config.Config) (*detector.Chain, *schemaregistry.Registry, error) {
+	registry, err := schemaregistry.NewRegistry(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize schema registry: %v", err)
+	}
+
+	return newDetectorChain(registry, cfg), registry, nil
+}
+
+// newDetectorChain wires the detectors that route YAML files to schemas.
+func newDetectorChain(registry *schemaregistry.Registry, cfg *config.Config) *detector.Chain {
+	groups := kubernetes.NewGroupIndex(registry, cfg)
+	clusterSource := cluster.NewSource(registry, cfg)
+	crdDetector := &kubernetes.CRDDetector{
+		Registry: registry,
+		Config:   cfg,
+		Groups:   groups,
+		Local:    kubernetes.NewLocalCRDIndex(cfg),
+		Cluster:  clusterSource,
+	}
+	k8sDetector := &kubernetes.K8sDetector{
+		Registry: registry,
+		Config:   cfg,
+		Groups:   groups,
+		Cluster:  clusterSource,
+		Fallback: crdDetector,
+	}
+
+	return detector.NewChain(k8sDetector, crdDetector)
+}
+
+// parseFlags defines the proxy flags on flags, parses args and returns a
+// config loader that applies the explicitly set ones as its
+// highest-precedence layer.
+func parseFlags(flags *flag.FlagSet, args []string) (*config.Loader, error) {
+	defaults := config.Default()
+
+	logFile := flags.String(
 		"log-file",
-		defaultLogPath,
+		defaults.LogFile,
 		"Path to write logs (don't log to stdout!)",
 	)
-	lspPath := flag.String(
+	lspPath := flags.String(
 		"lsp-path",
-		"yaml-language-server",
+		defaults.LSPPath,
 		"Path to the yaml-language-server executable. Defaults to checking the system PATH.",
 	)
-	_ = flag.Bool(
+	lspArgs := flags.String(
+		"lsp-args",
+		strings.Join(defaults.LSPArgs, " "),
+		"Whitespace separated arguments passed to the yaml-language-server.",
+	)
+	logLevel := flags.String(
+		"log-level",
+		defaults.LogLevel,
+		"Log verbosity: debug, info or off.",
+	)
+	_ = flags.Bool(
 		"stdio",
 		true,
 		"Ignored. Kept for compatibility with LSP clients that automatically append it.",
 	)
-	flag.Parse()
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
 
-	log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+	// Only flags given explicitly on the command line override the config files
+	// and environment variables.
+	return config.NewLoader(func(cfg *config.Config) {
+		flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "log-file":
+				cfg.LogFile = *logFile
+			case "log-level":
+				cfg.LogLevel = *logLevel
+			case "lsp-path":
+				cfg.LSPPath = *lspPath
+			case "lsp-args":
+				cfg.LSPArgs = strings.Fields(*lspArgs)
+			}
+		})
+	}), nil
+}
 
-	if *logFile != "" {
-		logDir := filepath.Dir(*logFile)
-		if err := os.MkdirAll(logDir, config.DefaultDirPerm); err != nil {
-			return err
-		}
+// setupLogging directs the standard logger according to the configured log
+// file and level. The returned function closes the log file.
+func setupLogging(cfg *config.Config) (func(), error) {
+	switch cfg.LogLevel {
+	case config.LogLevelOff:
+		log.SetOutput(io.Discard)
+		return func() {}, nil
+	case config.LogLevelDebug:
+		log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile)
+	case config.LogLevelInfo:
+		log.SetFlags(log.Ldate | log.Ltime | log.Lmicroseconds)
+	default:
+		return nil, fmt.Errorf("unknown log level %q", cfg.LogLevel)
+	}
 
-		f, err := os.OpenFile(*logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, config.DefaultFilePerm)
-		if err != nil {
-			return err
-		}
-		defer func() {
-			if err := f.Close(); err != nil {
-				log.Printf("[%s] error closing file: %v", componentName, err)
-			}
-		}()
-		log.SetOutput(f)
-	} else {
+	if cfg.LogFile == "" {
 		log.SetOutput(os.Stderr)
+		return func() {}, nil
 	}
 
-	log.Printf("[%s] Starting yaml-schema-router. Using LSP executable: %s", componentName, *lspPath)
-
-	registry, err := schemaregistry.NewRegistry()
-	if err != nil {
-		return fmt.Errorf("failed to initialize schema registry: %v", err)
+	logDir := filepath.Dir(cfg.LogFile)
+	if err := os.MkdirAll(logDir, config.DefaultDirPerm); err != nil {
+		return nil, err
 	}
 
-	k8sDetector := &kubernetes.K8sDetector{Registry: registry}
-	crdDetector := &kubernetes.CRDDetector{Registry: registry}
-	chain := detector.NewChain(k8sDetector, crdDetector)
-
-	proxy := lspproxy.NewProxy(*lspPath, chain, registry)
-
-	if err := proxy.Start(ctx); err != nil {
-		return err
+	f, err := os.OpenFile(cfg.LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, config.DefaultFilePerm)
+	if err != nil {
+		return nil, err
 	}
+	log.SetOutput(f)
 
-	log.Printf("[%s] Proxy shut down cleanly.", componentName)
-
-	return nil
+	return func() {
+		if err := f.Close(); err != nil {
+			log.Printf("[%s] error closing file: %v", componentName, err)
+		}
+	}, nil
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/detector/kubernetes"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemapack"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runPack implements "yaml-schema-router pack build", which writes the
+// schemas of Kubernetes versions and directories of schemas into a schema
+// pack archive.
+func runPack(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "build" {
+		return errors.New("usage: yaml-schema-router pack build --output FILE [flags]")
+	}
+
+	flags := flag.NewFlagSet("pack build", flag.ContinueOnError)
+	output := flags.String("output", "", "Path of the schema pack to write (required).")
+	flavour := flags.String("flavour", "",
+		"Schema flavour of the Kubernetes versions. Defaults to the configured flavour.")
+	var versions, dirs stringList
+	flags.Var(&versions, "kubernetes-version",
+		"Kubernetes version whose built-in schemas are downloaded into the pack. Repeatable. "+
+			"Defaults to the configured version unless --dir is given.")
+	flags.Var(&dirs, "dir",
+		"NAME=DIR adds the JSON files below DIR under the cache directory NAME, "+
+			"e.g. kubernetes-crd=./CRDs-catalog. Repeatable.")
+	core := flags.Bool("core", false,
+		"Only add the schemas of the core kinds, such as Deployment and Service, and ObjectMeta.")
+	defaults := flags.Bool("defaults", false,
+		"Ignore the user and project configuration and YAML_SCHEMA_ROUTER_* variables, and download "+
+			"into an empty cache, so the pack only depends on the flags and the default settings.")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *output == "" {
+		return errors.New("--output is required")
+	}
+
+	environment := loadCommandEnvironment
+	if *defaults {
+		environment = defaultPackEnvironment
+	}
+	cfg, registry, closeEnvironment, err := environment()
+	if err != nil {
+		return err
+	}
+	defer closeEnvironment()
+
+	if *flavour == "" {
+		*flavour = cfg.Kubernetes.Flavour
+	}
+	if len(versions) == 0 && len(dirs) == 0 {
+		versions = append(versions, cfg.Kubernetes.Version)
+	}
+
+	files := make(map[string][]byte)
+	for _, version := range versions {
+		if err := addKubernetesVersion(ctx, files, registry, cfg, version, *flavour, *core); err != nil {
+			return err
+		}
+	}
+	for _, dir := range dirs {
+		if err := addSchemaDir(files, dir); err != nil {
+			return err
+		}
+	}
+
+	if err := writePack(*output, files); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %d schemas to %s\n", len(files), *output)
+	return nil
+}
+
+// defaultPackEnvironment is loadCommandEnvironment with the default
+// configuration and a temporary cache, which it removes when closed.
+func defaultPackEnvironment() (*config.Config, *schemaregistry.Registry, func(), error) {
+	cfg := config.Default()
+
+	cacheDir, err := os.MkdirTemp("", "yaml-schema-router-pack-")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	removeCache := func() {
+		_ = os.RemoveAll(cacheDir)
+	}
+
+	closeLog, err := setupLogging(cfg)
+	if err != nil {
+		removeCache()
+		return nil, nil, nil, err
+	}
+
+	registry, err := schemaregistry.NewRegistryIn(cfg, cacheDir)
+	if err != nil {
+		closeLog()
+		removeCache()
+		return nil, nil, nil, fmt.Errorf("failed to initialize schema registry: %w", err)
+	}
+
+	return cfg, registry, func() {
+		closeLog()
+		removeCache()
+	}, nil
+}
+
+// addKubernetesVersion downloads the built-in schemas of a version, or only
+// those of the core kinds, and adds them to files under their cache paths.
+func addKubernetesVersion(
+	ctx context.Context,
+	files map[string][]byte,
+	registry *schemaregistry.Registry,
+	cfg *config.Config,
+	version, flavour string,
+	core bool,
+) error {
+	prefetch := kubernetes.PrefetchBuiltin
+	if core {
+		prefetch = kubernetes.PrefetchCore
+	}
+
+	fmt.Fprintf(os.Stderr, "Downloading the %s schemas of Kubernetes %s ...\n", flavour, version)
+
+	uris, err := prefetch(ctx, registry, cfg, version, flavour)
+	if err != nil {
+		return err
+	}
+
+	cacheDir := registry.GetLocalPath("")
+	for _, uri := range uris {
+		// A pack must not be built from the copies of another one
+		if entry, ok := registry.Entry(uri); ok && entry.Pack != "" {
+			return fmt.Errorf("%s could not be downloaded and is only in schema pack %s", entry.Path, entry.Pack)
+		}
+
+		path, _ := fileuri.ToPath(uri)
+		rel, err := filepath.Rel(cacheDir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path) //nolint:gosec // the path lives inside the schema cache
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+	}
+
+	return nil
+}
+
+// addSchemaDir adds the JSON files of a NAME=DIR argument to files.
+func addSchemaDir(files map[string][]byte, arg string) error {
+	name, dir, ok := strings.Cut(arg, "=")
+	if !ok || name == "" || dir == "" {
+		return fmt.Errorf("invalid --dir %q, expected NAME=DIR", arg)
+	}
+
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path) //nolint:gosec // the directory is given on the command line
+		if err != nil {
+			return err
+		}
+
+		files[name+"/"+filepath.ToSlash(rel)] = data
+		return nil
+	})
+}
+
+func writePack(path string, files map[string][]byte) (err error) {
+	f, err := os.Create(path) //nolint:gosec // the output is given on the command line
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return schemapack.Write(f, files)
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/validation"
+)
+
+// Output formats of validation results, besides text and json.
+const (
+	formatSARIF  = "sarif"
+	formatJUnit  = "junit"
+	formatGitHub = "github"
+)
+
+// toolName and toolURI identify the router in machine-readable reports.
+const (
+	toolName = "yaml-schema-router"
+	toolURI  = "https://github.com/traiproject/yaml-schema-router"
+)
+
+// Rules of validation findings in SARIF and JUnit reports.
+const (
+	ruleSchema = "schema"
+	ruleSyntax = "syntax"
+	ruleError  = "error"
+)
+
+// validationWriters write validation results in each output format.
+var validationWriters = map[string]func(io.Writer, []validation.Result) error{
+	formatText:   writeValidationText,
+	formatJSON:   writeValidationJSON,
+	formatSARIF:  writeValidationSARIF,
+	formatJUnit:  writeValidationJUnit,
+	formatGitHub: writeValidationGitHub,
+}
+
+// reportPath returns path relative to the current directory with forward
+// slashes, as code scanning and annotations expect repository paths.
+func reportPath(path string) string {
+	if filepath.IsAbs(path) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, path); err == nil && filepath.IsLocal(rel) {
+				path = rel
+			}
+		}
+	}
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// findingRule returns the rule a finding is reported under.
+func findingRule(finding validation.Finding) string {
+	if finding.Syntax {
+		return ruleSyntax
+	}
+	return ruleSchema
+}
+
+// findingMessage prefixes the message of a finding with the JSON pointer of
+// the offending value.
+func findingMessage(finding validation.Finding) string {
+	if finding.Path == "" {
+		return finding.Message
+	}
+	return finding.Path + ": " + finding.Message
+}
+
+// jsonResult is the JSON report of a file.
+type jsonResult struct {
+	File       string        `json:"file"`
+	Schema     string        `json:"schema,omitempty"`
+	Annotation string        `json:"annotation,omitempty"`
+	Documents  int           `json:"documents"`
+	Findings   []jsonFinding `json:"findings"`
+	Error      string        `json:"error,omitempty"`
+}
+
+// jsonFinding is a finding in the JSON report.
+type jsonFinding struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+	Rule    string `json:"rule"`
+	Schema  string `json:"schema,omitempty"`
+}
+
+// writeValidationJSON prints an array with the schema, findings and error of
+// every file, for scripts.
+func writeValidationJSON(w io.Writer, results []validation.Result) error {
+	out := make([]jsonResult, 0, len(results))
+	for _, result := range results {
+		r := jsonResult{
+			File:       reportPath(result.Path),
+			Schema:     result.Schema,
+			Annotation: result.Annotation,
+			Documents:  result.Documents,
+			Findings:   make([]jsonFinding, 0, len(result.Findings)),
+		}
+		if result.Err != nil {
+			r.Error = result.Err.Error()
+		}
+		for _, finding := range result.Findings {
+			r.Findings = append(r.Findings, jsonFinding{
+				Line:    finding.Line,
+				Column:  finding.Column,
+				Path:    finding.Path,
+				Message: finding.Message,
+				Rule:    findingRule(finding),
+				Schema:  finding.Schema,
+			})
+		}
+		out = append(out, r)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(out)
+}
+
+// sarifVersion is the version of the SARIF format code scanning accepts.
+const sarifVersion = "2.1.0"
+
+// sarifSchema is the JSON Schema of SARIF 2.1.0 logs.
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// sarifLog is the root of a SARIF log.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun holds the results of one run of a tool.
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+// sarifTool describes the tool that produced a run.
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+// sarifDriver names the tool and the rules its results refer to.
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+// sarifRule describes a rule results are reported under.
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+// sarifMessage is a plain text message.
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// sarifResult is a finding or a file that could not be validated.
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+// sarifLocation is where a result was found.
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+// sarifPhysicalLocation is a file and, for findings, the region within it.
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+// sarifArtifactLocation is the path of a file relative to the repository.
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// sarifRegion is the 1-based line and column a finding starts at.
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeValidationSARIF prints a SARIF log with one result per finding and
+// per file that could not be validated, for code-scanning dashboards.
+func writeValidationSARIF(w io.Writer, results []validation.Result) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			InformationURI: toolURI,
+			Rules: []sarifRule{
+				{ID: ruleSchema, ShortDescription: sarifMessage{Text: "Document does not match its schema"}},
+				{ID: ruleSyntax, ShortDescription: sarifMessage{Text: "YAML syntax error"}},
+				{ID: ruleError, ShortDescription: sarifMessage{Text: "File could not be validated"}},
+			},
+		}},
+		Results: []sarifResult{},
+	}
+
+	for _, result := range results {
+		artifact := sarifArtifactLocation{URI: reportPath(result.Path)}
+		if result.Err != nil {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    ruleError,
+				Level:     "error",
+				Message:   sarifMessage{Text: result.Err.Error()},
+				Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: artifact}}},
+			})
+		}
+		for _, finding := range result.Findings {
+			region := &sarifRegion{StartLine: finding.Line, StartColumn: finding.Column}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  findingRule(finding),
+				Level:   "error",
+				Message: sarifMessage{Text: findingMessage(finding)},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: artifact, Region: region},
+				}},
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []sarifRun{run}})
+}
+
+// junitTestSuites is the root of a JUnit report.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+// junitTestSuite holds the test cases of a validation run.
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+// junitTestCase is the outcome of validating one file.
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitProblem `xml:"skipped,omitempty"`
+}
+
+// junitProblem is the failure, error or reason for skipping a test case.
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",cdata"`
+}
+
+// writeValidationJUnit reports every file as a test case, failed if it has
+// findings and skipped if it has no detected schema.
+func writeValidationJUnit(w io.Writer, results []validation.Result) error {
+	suite := junitTestSuite{Name: toolName + " validate", Tests: len(results)}
+
+	for _, result := range results {
+		path := reportPath(result.Path)
+		testCase := junitTestCase{ClassName: toolName, Name: path}
+
+		switch {
+		case result.Err != nil:
+			suite.Errors++
+			testCase.Error = &junitProblem{Message: result.Err.Error(), Type: ruleError}
+		case len(result.Findings) > 0:
+			suite.Failures++
+			testCase.Failure = junitFailure(path, result.Findings)
+		case result.Annotation != "":
+			suite.Skipped++
+			testCase.Skipped = &junitProblem{Message: "manual schema annotation " + result.Annotation}
+		case result.Schema == "":
+			suite.Skipped++
+			testCase.Skipped = &junitProblem{Message: "no schema detected"}
+		}
+
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+
+	report := junitTestSuites{
+		Name:     toolName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// junitFailure lists the findings of a file one "file:line:column: message"
+// line each.
+func junitFailure(path string, findings []validation.Finding) *junitProblem {
+	var text strings.Builder
+	for _, finding := range findings {
+		fmt.Fprintf(&text, "%s:%d:", path, finding.Line)
+		if finding.Column > 0 {
+			fmt.Fprintf(&text, "%d:", finding.Column)
+		}
+		fmt.Fprintf(&text, " %s\n", findingMessage(finding))
+	}
+
+	return &junitProblem{
+		Message: fmt.Sprintf("%d problems", len(findings)),
+		Type:    ruleSchema,
+		Text:    text.String(),
+	}
+}
+
+// writeValidationGitHub prints GitHub Actions workflow commands, which show
+// up as annotations on the changed lines of a pull request.
+func writeValidationGitHub(w io.Writer, results []validation.Result) error {
+	var b strings.Builder
+
+	for _, result := range results {
+		path := reportPath(result.Path)
+		if result.Err != nil {
+			fmt.Fprintf(&b, "::error file=%s,title=%s::%s\n",
+				githubProperty(path), githubProperty("Validation error"), githubData(result.Err.Error()))
+		}
+		for _, finding := range result.Findings {
+			title := "Schema violation"
+			if finding.Syntax {
+				title = "YAML syntax error"
+			}
+
+			fmt.Fprintf(&b, "::error file=%s,line=%d", githubProperty(path), finding.Line)
+			if finding.Column > 0 {
+				fmt.Fprintf(&b, ",col=%d", finding.Column)
+			}
+			fmt.Fprintf(&b, ",title=%s::%s\n", githubProperty(title), githubData(findingMessage(finding)))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// githubData escapes the message of a workflow command.
+func githubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// githubProperty escapes a property value of a workflow command.
+func githubProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(githubData(s))
+}
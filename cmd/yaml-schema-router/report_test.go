@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/validation"
+)
+
+// reportResults covers every kind of result the writers distinguish.
+var reportResults = []validation.Result{
+	{
+		Path:      "deploy/app.yaml",
+		Schema:    "file:///cache/deployment.json",
+		Documents: 2,
+		Findings: []validation.Finding{
+			{
+				Line: 4, Column: 13, Path: "/spec/replicas",
+				Message: "got string, want integer", Schema: "file:///cache/deployment.json",
+			},
+			{Line: 9, Message: "mapping values are not allowed, in this context\nsee line 8", Syntax: true},
+		},
+	},
+	{Path: "deploy/ok.yaml", Schema: "file:///cache/service.json", Documents: 1},
+	{Path: "docs/notes.yaml", Documents: 1},
+	{Path: "ci/pipeline.yaml", Annotation: "https://example.com/pipeline.json", Documents: 1},
+	{Path: "broken/a,b.yaml", Err: errors.New("open broken/a,b.yaml: permission denied")},
+}
+
+func writeReport(t *testing.T, format string) string {
+	t.Helper()
+
+	var out strings.Builder
+	if err := validationWriters[format](&out, reportResults); err != nil {
+		t.Fatalf("writing %s report: %v", format, err)
+	}
+	return out.String()
+}
+
+func TestValidationWriters(t *testing.T) {
+	tests := []struct {
+		format string
+		check  func(t *testing.T, out string)
+	}{
+		{format: formatSARIF, check: checkSARIF},
+		{format: formatJUnit, check: checkJUnit},
+		{format: formatGitHub, check: checkGitHub},
+		{format: formatJSON, check: checkJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			tt.check(t, writeReport(t, tt.format))
+		})
+	}
+}
+
+func checkSARIF(t *testing.T, out string) {
+	t.Helper()
+
+	var report sarifLog
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid SARIF: %v", err)
+	}
+	if report.Version != sarifVersion || len(report.Runs) != 1 {
+		t.Fatalf("SARIF version %q with %d runs, want %q with one run", report.Version, len(report.Runs), sarifVersion)
+	}
+
+	type location struct {
+		rule, uri    string
+		line, column int
+	}
+	want := []location{
+		{rule: ruleSchema, uri: "deploy/app.yaml", line: 4, column: 13},
+		{rule: ruleSyntax, uri: "deploy/app.yaml", line: 9},
+		{rule: ruleError, uri: "broken/a,b.yaml"},
+	}
+
+	results := report.Runs[0].Results
+	if len(results) != len(want) {
+		t.Fatalf("SARIF has %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		physical := result.Locations[0].PhysicalLocation
+		got := location{rule: result.RuleID, uri: physical.ArtifactLocation.URI}
+		if physical.Region != nil {
+			got.line, got.column = physical.Region.StartLine, physical.Region.StartColumn
+		}
+		if got != want[i] {
+			t.Errorf("SARIF result %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+	if msg := results[0].Message.Text; msg != "/spec/replicas: got string, want integer" {
+		t.Errorf("SARIF message = %q, want the path and message", msg)
+	}
+}
+
+func checkJUnit(t *testing.T, out string) {
+	t.Helper()
+
+	if !strings.HasPrefix(out, xml.Header) {
+		t.Errorf("JUnit report does not start with the XML header")
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("invalid JUnit: %v", err)
+	}
+	if report.Tests != 5 || report.Failures != 1 || report.Errors != 1 || len(report.Suites) != 1 {
+		t.Errorf("JUnit totals = %d tests, %d failures, %d errors in %d suites, want 5, 1, 1 in one suite",
+			report.Tests, report.Failures, report.Errors, len(report.Suites))
+	}
+
+	suite := report.Suites[0]
+	if suite.Skipped != 2 || len(suite.TestCases) != 5 {
+		t.Fatalf("JUnit suite = %d skipped of %d cases, want 2 of 5", suite.Skipped, len(suite.TestCases))
+	}
+
+	failure := suite.TestCases[0].Failure
+	wantText := "deploy/app.yaml:4:13: /spec/replicas: got string, want integer\n" +
+		"deploy/app.yaml:9: mapping values are not allowed, in this context\nsee line 8\n"
+	if failure == nil || failure.Text != wantText || failure.Message != "2 problems" {
+		t.Errorf("JUnit failure = %+v, want %q", failure, wantText)
+	}
+	if suite.TestCases[1].Failure != nil || suite.TestCases[1].Skipped != nil {
+		t.Errorf("JUnit case of a valid file = %+v, want it passed", suite.TestCases[1])
+	}
+	if skipped := suite.TestCases[2].Skipped; skipped == nil || skipped.Message != "no schema detected" {
+		t.Errorf("JUnit case without schema skipped = %+v, want no schema detected", skipped)
+	}
+	if skipped := suite.TestCases[3].Skipped; skipped == nil || !strings.Contains(skipped.Message, "annotation") {
+		t.Errorf("JUnit case with annotation skipped = %+v, want the annotation", skipped)
+	}
+	if problem := suite.TestCases[4].Error; problem == nil || problem.Type != ruleError {
+		t.Errorf("JUnit case of an unreadable file error = %+v, want an error", problem)
+	}
+}
+
+func checkGitHub(t *testing.T, out string) {
+	t.Helper()
+
+	want := "::error file=deploy/app.yaml,line=4,col=13,title=Schema violation::" +
+		"/spec/replicas: got string, want integer\n" +
+		"::error file=deploy/app.yaml,line=9,title=YAML syntax error::" +
+		"mapping values are not allowed, in this context%0Asee line 8\n" +
+		"::error file=broken/a%2Cb.yaml,title=Validation error::" +
+		"open broken/a,b.yaml: permission denied\n"
+	if out != want {
+		t.Errorf("GitHub annotations =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func checkJSON(t *testing.T, out string) {
+	t.Helper()
+
+	var results []jsonResult
+	if err := json.Unmarshal([]byte(out), &results); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(results) != len(reportResults) {
+		t.Fatalf("JSON has %d results, want %d", len(results), len(reportResults))
+	}
+	if rules := results[0].Findings[0].Rule + "," + results[0].Findings[1].Rule; rules != "schema,syntax" {
+		t.Errorf("JSON rules = %s, want schema,syntax", rules)
+	}
+	if results[1].Findings == nil || len(results[1].Findings) != 0 {
+		t.Errorf("JSON findings of a valid file = %v, want an empty list", results[1].Findings)
+	}
+	if results[4].Error == "" {
+		t.Errorf("JSON result of an unreadable file has no error")
+	}
+}
+
+func TestReportPath(t *testing.T) {
+	wd := t.TempDir()
+	t.Chdir(wd)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "relative", path: "deploy/./app.yaml", want: "deploy/app.yaml"},
+		{name: "inside the working directory", path: wd + "/deploy/app.yaml", want: "deploy/app.yaml"},
+		{name: "outside the working directory", path: "/etc/app.yaml", want: "/etc/app.yaml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reportPath(tt.path); got != tt.want {
+				t.Errorf("reportPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
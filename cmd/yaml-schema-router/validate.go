@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/validation"
+)
+
+// runValidate implements "yaml-schema-router validate", which validates YAML
+// files against the schemas the router routes them to, so CI enforces what
+// editors show.
+func runValidate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: yaml-schema-router validate [--format FORMAT] [--allow-unresolved] [PATH...]")
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", formatText, "Output format: text, json, sarif, junit or github.")
+	allowUnresolved := flags.Bool("allow-unresolved", false,
+		"Skip documents whose schema could not be fetched instead of failing.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	write, ok := validationWriters[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	cfg, registry, closeLog, err := loadCommandEnvironment()
+	if err != nil {
+		return err
+	}
+	defer closeLog()
+
+	validator := validation.NewValidator(registry, newDetectorChain(registry, cfg))
+	validator.AllowUnresolved = *allowUnresolved
+
+	var results []validation.Result
+	for _, root := range paths {
+		err := walkYAMLFiles(root, func(path string) error {
+			results = append(results, validator.ValidateFile(ctx, path))
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := write(os.Stdout, results); err != nil {
+		return err
+	}
+
+	return validationSummary(results)
+}
+
+// writeValidationText prints one "file:line:column: message" line per
+// finding, the format editors and terminals link to the location.
+func writeValidationText(w io.Writer, results []validation.Result) error {
+	var b strings.Builder
+
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(&b, "%s: error: %v\n", result.Path, result.Err)
+		}
+		for _, finding := range result.Findings {
+			fmt.Fprintf(&b, "%s:%d:", result.Path, finding.Line)
+			if finding.Column > 0 {
+				fmt.Fprintf(&b, "%d:", finding.Column)
+			}
+			if finding.Path != "" {
+				fmt.Fprintf(&b, " %s:", finding.Path)
+			}
+			fmt.Fprintf(&b, " %s\n", finding.Message)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// validationSummary prints how many files were validated and returns an
+// error if any failed, so the exit code fails CI.
+func validationSummary(results []validation.Result) error {
+	var validated, unrouted, annotated, failed, findings int
+	for _, result := range results {
+		switch {
+		case result.Annotation != "":
+			annotated++
+		case result.Schema == "" && result.Err == nil:
+			unrouted++
+		default:
+			validated++
+		}
+		if result.Failed() {
+			failed++
+		}
+		findings += len(result.Findings)
+	}
+
+	fmt.Fprintf(os.Stderr, "Validated %d files", validated)
+	if unrouted > 0 {
+		fmt.Fprintf(os.Stderr, ", %d without a detected schema", unrouted)
+	}
+	if annotated > 0 {
+		fmt.Fprintf(os.Stderr, ", %d with a manual schema annotation", annotated)
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if failed > 0 {
+		return fmt.Errorf("%d problems in %d of %d files", findings, failed, len(results))
+	}
+	return nil
+}
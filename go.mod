@@ -1,3 +1,9 @@
 module go.trai.ch/yaml-schema-router
 
 go 1.25
+
+require (
+	github.com/santhosh-tekuri/jsonschema/v6 v6.0.2
+	go.yaml.in/yaml/v3 v3.0.4
+	golang.org/x/text v0.14.0
+)
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Client fetches paths from an API server. It is the seam for talking to a
+// fake API server instead of the one selected by the kubeconfig.
+type Client interface {
+	Get(ctx context.Context, path string) ([]byte, error)
+}
+
+// StatusError reports a non-2xx response from the API server.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status: %d", e.StatusCode)
+}
+
+// HTTPClient is a Client for an API server reachable over HTTP(S).
+type HTTPClient struct {
+	Server string
+	HTTP   *http.Client
+}
+
+// Get fetches a server-relative path such as "/openapi/v3".
+func (c *HTTPClient) Get(ctx context.Context, path string) ([]byte, error) {
+	url := strings.TrimSuffix(c.Server, "/") + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,351 @@
+// Package cluster reads schemas from the OpenAPI v3 endpoint of a Kubernetes
+// API server selected through a kubeconfig context.
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+// execInfoEnv passes the ExecCredential request to credential plugins.
+const execInfoEnv = "KUBERNETES_EXEC_INFO"
+
+// kubeconfig holds the parts of a kubeconfig file needed to reach a cluster.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+			TLSServerName            string `yaml:"tls-server-name"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string   `yaml:"name"`
+		User userInfo `yaml:"user"`
+	} `yaml:"users"`
+}
+
+type userInfo struct {
+	Token                 string      `yaml:"token"`
+	TokenFile             string      `yaml:"tokenFile"`
+	ClientCertificate     string      `yaml:"client-certificate"`
+	ClientCertificateData string      `yaml:"client-certificate-data"`
+	ClientKey             string      `yaml:"client-key"`
+	ClientKeyData         string      `yaml:"client-key-data"`
+	Username              string      `yaml:"username"`
+	Password              string      `yaml:"password"`
+	Exec                  *execConfig `yaml:"exec"`
+}
+
+// execConfig is a client-go credential plugin.
+type execConfig struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Command    string   `yaml:"command"`
+	Args       []string `yaml:"args"`
+	Env        []struct {
+		Name  string `yaml:"name"`
+		Value string `yaml:"value"`
+	} `yaml:"env"`
+}
+
+// execCredential is the response of a credential plugin.
+type execCredential struct {
+	Status struct {
+		Token                 string `json:"token"`
+		ClientCertificateData string `json:"clientCertificateData"`
+		ClientKeyData         string `json:"clientKeyData"`
+	} `json:"status"`
+}
+
+// endpoint is an API server together with the credentials to reach it.
+type endpoint struct {
+	Context  string
+	Server   string
+	TLS      *tls.Config
+	Token    string
+	Username string
+	Password string
+}
+
+// DefaultKubeconfigPath returns the first file of $KUBECONFIG, falling back
+// to ~/.kube/config.
+func DefaultKubeconfigPath() string {
+	if paths := filepath.SplitList(os.Getenv("KUBECONFIG")); len(paths) > 0 && paths[0] != "" {
+		return paths[0]
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".kube", "config")
+}
+
+// kubeconfigPath returns the kubeconfig to read for the configured path. A
+// relative path is resolved against the user configuration directory rather
+// than the working directory, which is usually the workspace the editor was
+// opened in and must not choose the credentials or plugins that are used.
+func kubeconfigPath(path string) (string, error) {
+	if path == "" {
+		return DefaultKubeconfigPath(), nil
+	}
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+
+	dir, err := config.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve kubeconfig %s: %w", path, err)
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// loadEndpoint resolves contextName, or the current context if it is empty,
+// of the kubeconfig at path. Relative file references are resolved against
+// the kubeconfig's directory, as kubectl does. Once the context is known, the
+// returned endpoint carries its name even if reading the credentials fails.
+func loadEndpoint(ctx context.Context, path, contextName string) (*endpoint, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // the kubeconfig location is configured by the user
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg kubeconfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %w", path, err)
+	}
+
+	if contextName == "" {
+		contextName = cfg.CurrentContext
+	}
+
+	clusterName, userName, err := cfg.context(contextName)
+	if err != nil {
+		return nil, err
+	}
+
+	ep := &endpoint{Context: contextName}
+	baseDir := filepath.Dir(path)
+
+	if err := cfg.applyCluster(ep, clusterName, baseDir); err != nil {
+		return ep, err
+	}
+	if err := cfg.applyUser(ctx, ep, userName, baseDir); err != nil {
+		return ep, err
+	}
+
+	return ep, nil
+}
+
+func (c *kubeconfig) context(name string) (clusterName, userName string, err error) {
+	if name == "" {
+		return "", "", errors.New("kubeconfig has no current context")
+	}
+
+	for _, entry := range c.Contexts {
+		if entry.Name == name {
+			return entry.Context.Cluster, entry.Context.User, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("context %q not found in kubeconfig", name)
+}
+
+func (c *kubeconfig) applyCluster(ep *endpoint, name, baseDir string) error {
+	for _, entry := range c.Clusters {
+		if entry.Name != name {
+			continue
+		}
+
+		cluster := entry.Cluster
+		ep.Server = cluster.Server
+		ep.TLS = &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			ServerName:         cluster.TLSServerName,
+			InsecureSkipVerify: cluster.InsecureSkipTLSVerify, //nolint:gosec // opted into by the kubeconfig
+		}
+
+		ca, err := dataOrFile(cluster.CertificateAuthorityData, cluster.CertificateAuthority, baseDir)
+		if err != nil {
+			return fmt.Errorf("failed to read certificate authority: %w", err)
+		}
+		if len(ca) > 0 {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return errors.New("certificate authority contains no PEM certificates")
+			}
+			ep.TLS.RootCAs = pool
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("cluster %q not found in kubeconfig", name)
+}
+
+func (c *kubeconfig) applyUser(ctx context.Context, ep *endpoint, name, baseDir string) error {
+	for _, entry := range c.Users {
+		if entry.Name != name {
+			continue
+		}
+
+		user := entry.User
+		if user.Exec != nil {
+			if err := runExecPlugin(ctx, user.Exec, &user); err != nil {
+				return err
+			}
+		}
+
+		return applyCredentials(ep, &user, baseDir)
+	}
+
+	// Contexts without a user talk to the API server anonymously.
+	return nil
+}
+
+func applyCredentials(ep *endpoint, user *userInfo, baseDir string) error {
+	cert, err := dataOrFile(user.ClientCertificateData, user.ClientCertificate, baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to read client certificate: %w", err)
+	}
+	key, err := dataOrFile(user.ClientKeyData, user.ClientKey, baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to read client key: %w", err)
+	}
+	if len(cert) > 0 && len(key) > 0 {
+		pair, err := tls.X509KeyPair(cert, key)
+		if err != nil {
+			return fmt.Errorf("invalid client certificate: %w", err)
+		}
+		ep.TLS.Certificates = []tls.Certificate{pair}
+	}
+
+	ep.Token = user.Token
+	if ep.Token == "" && user.TokenFile != "" {
+		token, err := os.ReadFile(resolvePath(user.TokenFile, baseDir))
+		if err != nil {
+			return fmt.Errorf("failed to read token file: %w", err)
+		}
+		ep.Token = string(bytes.TrimSpace(token))
+	}
+
+	ep.Username, ep.Password = user.Username, user.Password
+	return nil
+}
+
+// runExecPlugin runs a client-go credential plugin and copies the returned
+// credentials onto user.
+func runExecPlugin(ctx context.Context, plugin *execConfig, user *userInfo) error {
+	request, err := json.Marshal(map[string]any{
+		"apiVersion": plugin.APIVersion,
+		"kind":       "ExecCredential",
+		"spec":       map[string]any{"interactive": false},
+	})
+	if err != nil {
+		return err
+	}
+
+	// The kubeconfig only comes from the user configuration, environment or flags
+	cmd := exec.CommandContext(ctx, plugin.Command, plugin.Args...) //nolint:gosec // see above
+	cmd.Env = append(os.Environ(), execInfoEnv+"="+string(request))
+	for _, env := range plugin.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("credential plugin %s failed: %w", plugin.Command, err)
+	}
+
+	var credential execCredential
+	if err := json.Unmarshal(output, &credential); err != nil {
+		return fmt.Errorf("credential plugin %s returned invalid output: %w", plugin.Command, err)
+	}
+
+	user.Token = credential.Status.Token
+	user.ClientCertificateData = ""
+	user.ClientKeyData = ""
+	if credential.Status.ClientCertificateData != "" {
+		user.ClientCertificate = ""
+		user.ClientKey = ""
+		user.ClientCertificateData = base64.StdEncoding.EncodeToString([]byte(credential.Status.ClientCertificateData))
+		user.ClientKeyData = base64.StdEncoding.EncodeToString([]byte(credential.Status.ClientKeyData))
+	}
+
+	return nil
+}
+
+// dataOrFile returns base64 decoded inline data, or the content of the
+// referenced file.
+func dataOrFile(data, file, baseDir string) ([]byte, error) {
+	if data != "" {
+		return base64.StdEncoding.DecodeString(data)
+	}
+	if file != "" {
+		return os.ReadFile(resolvePath(file, baseDir))
+	}
+	return nil, nil
+}
+
+func resolvePath(path, baseDir string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+// newHTTPClient returns a client authenticating against ep.
+func newHTTPClient(ep *endpoint, timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = ep.TLS
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &authTransport{endpoint: ep, next: transport},
+	}
+}
+
+// authTransport adds the endpoint's bearer token or basic auth to requests.
+type authTransport struct {
+	endpoint *endpoint
+	next     http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch {
+	case t.endpoint.Token != "":
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+t.endpoint.Token)
+	case t.endpoint.Username != "":
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(t.endpoint.Username, t.endpoint.Password)
+	}
+
+	return t.next.RoundTrip(req)
+}
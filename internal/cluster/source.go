@@ -0,0 +1,456 @@
+package cluster
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/openapi"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const (
+	componentName = "Cluster"
+
+	openAPIV3Path = "/openapi/v3"
+
+	// unversionedHash names documents of API servers that don't version them.
+	unversionedHash = "current"
+)
+
+// ErrNotFound reports that the cluster does not serve the requested kind.
+var ErrNotFound = errors.New("kind not served by the cluster")
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// Source materializes per-kind JSON schemas from the OpenAPI v3 documents of
+// an API server into the registry cache. Every fetched document is kept as a
+// snapshot, so schemas keep resolving while the cluster is unreachable.
+type Source struct {
+	Registry *schemaregistry.Registry
+	Config   *config.Config
+
+	// Client, if set, replaces the client built from the kubeconfig.
+	Client Client
+
+	mu        sync.Mutex
+	target    string
+	context   string
+	client    Client
+	index     map[string]string
+	fetchedAt time.Time
+	retryAt   time.Time
+	documents map[string]*document
+}
+
+// openAPIIndex is the discovery document served at /openapi/v3.
+type openAPIIndex struct {
+	Paths map[string]struct {
+		ServerRelativeURL string `json:"serverRelativeURL"`
+	} `json:"paths"`
+}
+
+// document is the OpenAPI v3 document of one group version.
+type document struct {
+	hash    string
+	schemas map[string]map[string]any
+}
+
+type groupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// NewSource creates a source for the cluster configured in cfg.
+func NewSource(registry *schemaregistry.Registry, cfg *config.Config) *Source {
+	return &Source{Registry: registry, Config: cfg}
+}
+
+// Enabled reports whether schemas should be read from the cluster.
+func (s *Source) Enabled() bool {
+	return s.Config.Cluster.Enabled
+}
+
+// SchemaURI returns the local URI of the schema of kind in the given group
+// ("" for the core group) and version. Strict schemas reject unknown fields.
+func (s *Source) SchemaURI(ctx context.Context, group, version, kind string, strict bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resetOnTargetChange()
+
+	index, err := s.loadIndex(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	gvPath := groupVersionPath(group, version)
+	relativeURL, ok := index[gvPath]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	doc, err := s.loadDocument(ctx, gvPath, relativeURL)
+	if err != nil {
+		return "", err
+	}
+
+	return s.materialize(doc, gvPath, groupVersionKind{Group: group, Version: version, Kind: kind}, strict)
+}
+
+// Probe connects to the configured cluster and fetches its OpenAPI v3
+// index, bypassing the snapshot. It returns the name of the kubeconfig
+// context and the number of group versions the cluster serves.
+func (s *Source) Probe(ctx context.Context) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resetOnTargetChange()
+
+	data, err := s.fetch(ctx, openAPIV3Path)
+	if err != nil {
+		return s.context, 0, err
+	}
+
+	index, err := parseIndex(data)
+	if err != nil {
+		return s.context, 0, err
+	}
+	return s.context, len(index), nil
+}
+
+// resetOnTargetChange drops all state when the configured kubeconfig or
+// context changed, e.g. after a project configuration was loaded.
+func (s *Source) resetOnTargetChange() {
+	target := s.Config.Cluster.Kubeconfig + "\x00" + s.Config.Cluster.Context
+	if target == s.target && s.documents != nil {
+		return
+	}
+
+	s.target = target
+	s.context = s.Config.Cluster.Context
+	s.client = nil
+	s.index = nil
+	s.fetchedAt = time.Time{}
+	s.retryAt = time.Time{}
+	s.documents = make(map[string]*document)
+}
+
+// connect returns the client for the configured cluster, creating it from
+// the kubeconfig on first use.
+func (s *Source) connect(ctx context.Context) (Client, error) {
+	if s.Client != nil {
+		if s.context == "" {
+			s.context = "default"
+		}
+		return s.Client, nil
+	}
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	path, err := kubeconfigPath(s.Config.Cluster.Kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ep, err := loadEndpoint(ctx, path, s.Config.Cluster.Context)
+	if ep != nil {
+		s.context = ep.Context
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.client = &HTTPClient{Server: ep.Server, HTTP: newHTTPClient(ep, s.Config.Registry.DownloadTimeout)}
+	return s.client, nil
+}
+
+// loadIndex returns the group versions served by the cluster. The index is
+// refreshed every refreshInterval; while the cluster is unreachable the last
+// snapshot is used and the cluster is only retried after the retry backoff.
+func (s *Source) loadIndex(ctx context.Context) (map[string]string, error) {
+	now := time.Now()
+	if s.index != nil && (now.Sub(s.fetchedAt) < s.Config.Cluster.RefreshInterval || now.Before(s.retryAt)) {
+		return s.index, nil
+	}
+	if s.index == nil && now.Before(s.retryAt) {
+		return nil, fmt.Errorf("cluster unavailable, retrying after %s", s.retryAt.Format(time.RFC3339))
+	}
+
+	data, err := s.fetch(ctx, openAPIV3Path)
+	if err == nil {
+		var index map[string]string
+		if index, err = parseIndex(data); err == nil {
+			s.index, s.fetchedAt = index, now
+			s.save(s.indexCachePath(), data)
+			return index, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	s.retryAt = now.Add(s.Config.Registry.RetryBackoff)
+	if s.index == nil {
+		s.index = s.cachedIndex()
+	}
+	if s.index == nil {
+		return nil, fmt.Errorf("failed to fetch %s and no snapshot is cached: %w", openAPIV3Path, err)
+	}
+
+	log.Printf("[%s] Using cached OpenAPI snapshot of %s: %v", componentName, s.context, err)
+	return s.index, nil
+}
+
+func (s *Source) cachedIndex() map[string]string {
+	data, err := s.Registry.ReadCached(s.indexCachePath())
+	if err != nil {
+		return nil
+	}
+
+	index, err := parseIndex(data)
+	if err != nil {
+		return nil
+	}
+	return index
+}
+
+// parseIndex maps every group version path, e.g. "apis/apps/v1", to the URL
+// of its document.
+func parseIndex(data []byte) (map[string]string, error) {
+	var raw openAPIIndex
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw.Paths) == 0 {
+		return nil, errors.New("OpenAPI v3 index lists no paths")
+	}
+
+	index := make(map[string]string, len(raw.Paths))
+	for path, entry := range raw.Paths {
+		index[path] = entry.ServerRelativeURL
+	}
+	return index, nil
+}
+
+// loadDocument returns the document of a group version, from memory, the
+// snapshot on disk or the API server, in that order. Documents are named
+// after the hash the index lists for them, so changes are picked up as soon
+// as the index is refreshed.
+func (s *Source) loadDocument(ctx context.Context, gvPath, relativeURL string) (*document, error) {
+	hash := documentHash(relativeURL)
+	if doc, ok := s.documents[gvPath]; ok && doc.hash == hash {
+		return doc, nil
+	}
+
+	cachePath := filepath.Join(s.contextDir(), "openapi", filepath.FromSlash(gvPath), hash+".json")
+	data, err := s.Registry.ReadCached(cachePath)
+	if err != nil {
+		if time.Now().Before(s.retryAt) {
+			return nil, fmt.Errorf("OpenAPI document of %s is not cached and the cluster is unavailable", gvPath)
+		}
+		if relativeURL == "" {
+			relativeURL = openAPIV3Path + "/" + gvPath
+		}
+		log.Printf("[%s] Fetching OpenAPI document of %s from %s", componentName, gvPath, s.context)
+		if data, err = s.fetch(ctx, relativeURL); err != nil {
+			// Only back off if the cluster is unreachable, not for missing documents
+			var statusErr *StatusError
+			if ctx.Err() == nil && !errors.As(err, &statusErr) {
+				s.retryAt = time.Now().Add(s.Config.Registry.RetryBackoff)
+			}
+			return nil, fmt.Errorf("failed to fetch OpenAPI document of %s: %w", gvPath, err)
+		}
+		s.save(cachePath, data)
+	}
+
+	var raw struct {
+		Components struct {
+			Schemas map[string]map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI document of %s: %w", gvPath, err)
+	}
+
+	doc := &document{hash: hash, schemas: raw.Components.Schemas}
+	s.documents[gvPath] = doc
+	return doc, nil
+}
+
+// materialize writes the JSON schema of a kind, with every component it
+// references as a definition, to the cache and returns its URI.
+func (s *Source) materialize(doc *document, gvPath string, gvk groupVersionKind, strict bool) (string, error) {
+	name, ok := doc.find(gvk)
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	suffix := ""
+	if strict {
+		suffix = "-strict"
+	}
+	fileName := fmt.Sprintf("%s_%s%s.json", strings.ToLower(gvk.Kind), shortHash(doc.hash), suffix)
+	cachePath := filepath.Join(s.contextDir(), schemaregistry.ClusterSchemasDir, filepath.FromSlash(gvPath), fileName)
+
+	if localURI, ok := s.Registry.CachedFileURI(cachePath); ok {
+		return localURI, nil
+	}
+
+	schema := openapi.ToJSONSchema(doc.schemas[name], strict)
+	definitions := make(map[string]any)
+	for _, ref := range doc.references(name) {
+		definitions[ref] = openapi.ToJSONSchema(doc.schemas[ref], strict)
+	}
+	if len(definitions) > 0 {
+		schema["definitions"] = definitions
+	}
+
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := s.Registry.SaveLocalSchema(cachePath, data); err != nil {
+		return "", err
+	}
+
+	log.Printf("[%s] Materialized schema of %s/%s from %s", componentName, gvPath, gvk.Kind, s.context)
+	return s.Registry.GetLocalFileURI(cachePath), nil
+}
+
+// find returns the name of the component annotated with gvk.
+func (d *document) find(gvk groupVersionKind) (string, bool) {
+	for name, schema := range d.schemas {
+		raw, err := json.Marshal(schema["x-kubernetes-group-version-kind"])
+		if err != nil {
+			continue
+		}
+
+		var gvks []groupVersionKind
+		if json.Unmarshal(raw, &gvks) != nil {
+			continue
+		}
+		for _, candidate := range gvks {
+			if candidate == gvk {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// references returns the components transitively referenced by a component.
+func (d *document) references(name string) []string {
+	seen := map[string]bool{name: true}
+	var refs []string
+
+	queue := []string{name}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		collectRefs(d.schemas[current], func(ref string) {
+			if !seen[ref] && d.schemas[ref] != nil {
+				seen[ref] = true
+				refs = append(refs, ref)
+				queue = append(queue, ref)
+			}
+		})
+	}
+
+	return refs
+}
+
+// collectRefs calls found with the component name of every reference in value.
+func collectRefs(value any, found func(string)) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if ref, ok := child.(string); ok && key == "$ref" {
+				if name, ok := strings.CutPrefix(ref, "#/components/schemas/"); ok {
+					found(name)
+				}
+				continue
+			}
+			collectRefs(child, found)
+		}
+	case []any:
+		for _, child := range v {
+			collectRefs(child, found)
+		}
+	}
+}
+
+// fetch gets a path from the API server, dropping kubeconfig clients on
+// failure so expired plugin credentials are renewed on the next attempt.
+func (s *Source) fetch(ctx context.Context, path string) ([]byte, error) {
+	client, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := client.Get(ctx, path)
+	if err != nil {
+		s.client = nil
+	}
+	return data, err
+}
+
+func (s *Source) save(cachePath string, data []byte) {
+	if err := s.Registry.SaveLocalSchema(cachePath, data); err != nil {
+		log.Printf("[%s] Failed to save %s: %v", componentName, cachePath, err)
+	}
+}
+
+// contextDir is the cache directory of the current context's snapshot.
+func (s *Source) contextDir() string {
+	name := s.context
+	if name == "" {
+		name = "default"
+	}
+	return filepath.Join(schemaregistry.ClusterDir, unsafePathChars.ReplaceAllString(name, "_"))
+}
+
+func (s *Source) indexCachePath() string {
+	return filepath.Join(s.contextDir(), "openapi-v3.json")
+}
+
+// groupVersionPath returns the path of a group version below /openapi/v3.
+func groupVersionPath(group, version string) string {
+	if group == "" {
+		return "api/" + version
+	}
+	return "apis/" + group + "/" + version
+}
+
+// documentHash extracts the content hash the index appends to document URLs.
+func documentHash(relativeURL string) string {
+	parsed, err := url.Parse(relativeURL)
+	if err != nil {
+		return unversionedHash
+	}
+
+	hash := unsafePathChars.ReplaceAllString(parsed.Query().Get("hash"), "_")
+	if hash == "" {
+		return unversionedHash
+	}
+	return hash
+}
+
+func shortHash(hash string) string {
+	sum := sha256.Sum256([]byte(hash))
+	return hex.EncodeToString(sum[:])[:16]
+}
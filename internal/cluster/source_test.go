@@ -0,0 +1,311 @@
+package cluster_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/cluster"
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const testToken = "secret-token"
+
+// widgetDocument is the OpenAPI v3 document of example.com/v1.
+const widgetDocument = `{
+  "components": {
+    "schemas": {
+      "com.example.v1.Widget": {
+        "type": "object",
+        "x-kubernetes-group-version-kind": [{"group": "example.com", "version": "v1", "kind": "Widget"}],
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "spec": {"$ref": "#/components/schemas/com.example.v1.WidgetSpec"}
+        }
+      },
+      "com.example.v1.WidgetSpec": {
+        "type": "object",
+        "properties": {
+          "size": {"type": "integer", "nullable": true},
+          "port": {"x-kubernetes-int-or-string": true}
+        }
+      },
+      "com.example.v1.Unrelated": {"type": "string"}
+    }
+  }
+}`
+
+// fakeAPIServer serves the OpenAPI v3 endpoints of an API server and counts
+// the requests per path.
+type fakeAPIServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newFakeAPIServer(t *testing.T) *fakeAPIServer {
+	t.Helper()
+
+	fake := &fakeAPIServer{requests: make(map[string]int)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/openapi/v3", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"paths": {
+			"apis/example.com/v1": {"serverRelativeURL": "/openapi/v3/apis/example.com/v1?hash=ABC123"}
+		}}`))
+	})
+	mux.HandleFunc("/openapi/v3/apis/example.com/v1", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(widgetDocument))
+	})
+
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		fake.requests[r.URL.Path]++
+		fake.mu.Unlock()
+
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(fake.Close)
+
+	return fake
+}
+
+func (f *fakeAPIServer) count(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[path]
+}
+
+// newTestConfig returns a configuration reading the cluster of server
+// through a kubeconfig in a temporary directory, with an empty cache.
+func newTestConfig(t *testing.T, server string) *config.Config {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	kubeconfig := filepath.Join(dir, "kubeconfig")
+	data := `apiVersion: v1
+kind: Config
+current-context: test
+clusters:
+  - name: test
+    cluster:
+      server: ` + server + `
+users:
+  - name: test
+    user:
+      token: ` + testToken + `
+contexts:
+  - name: test
+    context:
+      cluster: test
+      user: test
+`
+	if err := os.WriteFile(kubeconfig, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.Cluster.Enabled = true
+	cfg.Cluster.Kubeconfig = kubeconfig
+	cfg.Cluster.RefreshInterval = time.Hour
+	cfg.Registry.RetryBackoff = time.Minute
+	return cfg
+}
+
+func newTestSource(t *testing.T, cfg *config.Config) *cluster.Source {
+	t.Helper()
+
+	registry, err := schemaregistry.NewRegistry(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cluster.NewSource(registry, cfg)
+}
+
+// readSchema reads the JSON schema a file:// URI points to.
+func readSchema(t *testing.T, uri string) map[string]any {
+	t.Helper()
+
+	path, ok := fileuri.ToPath(uri)
+	if !ok {
+		t.Fatalf("schema URI %q is not a file URI", uri)
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // the path is in the test's cache directory
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid schema %s: %v", uri, err)
+	}
+	return schema
+}
+
+func TestSourceProbe(t *testing.T) {
+	server := newFakeAPIServer(t)
+	source := newTestSource(t, newTestConfig(t, server.URL))
+
+	contextName, groupVersions, err := source.Probe(t.Context())
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if contextName != "test" || groupVersions != 1 {
+		t.Errorf("Probe() = %q, %d, want %q, %d", contextName, groupVersions, "test", 1)
+	}
+}
+
+func TestSourceSchemaURI(t *testing.T) {
+	tests := []struct {
+		name   string
+		strict bool
+
+		// wantAdditional is the additionalProperties of the spec definition,
+		// or nil if it must not be set.
+		wantAdditional any
+	}{
+		{name: "strict", strict: true, wantAdditional: false},
+		{name: "lenient", strict: false, wantAdditional: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAPIServer(t)
+			source := newTestSource(t, newTestConfig(t, server.URL))
+
+			uri, err := source.SchemaURI(t.Context(), "example.com", "v1", "Widget", tt.strict)
+			if err != nil {
+				t.Fatalf("SchemaURI() error = %v", err)
+			}
+			if tt.strict && !strings.HasSuffix(uri, "-strict.json") {
+				t.Errorf("SchemaURI() = %q, want a strict schema", uri)
+			}
+
+			schema := readSchema(t, uri)
+			spec, _ := schema["properties"].(map[string]any)["spec"].(map[string]any)
+			if ref := spec["$ref"]; ref != "#/definitions/com.example.v1.WidgetSpec" {
+				t.Errorf("spec $ref = %v, want the WidgetSpec definition", ref)
+			}
+
+			definitions, _ := schema["definitions"].(map[string]any)
+			if _, ok := definitions["com.example.v1.Unrelated"]; ok || len(definitions) != 1 {
+				t.Errorf("definitions = %v, want only WidgetSpec", definitions)
+			}
+			specDefinition, _ := definitions["com.example.v1.WidgetSpec"].(map[string]any)
+			if got := specDefinition["additionalProperties"]; got != tt.wantAdditional {
+				t.Errorf("WidgetSpec additionalProperties = %v, want %v", got, tt.wantAdditional)
+			}
+
+			properties, _ := specDefinition["properties"].(map[string]any)
+			size, _ := properties["size"].(map[string]any)
+			if types, _ := json.Marshal(size["type"]); string(types) != `["integer","null"]` {
+				t.Errorf("nullable size type = %s, want integer or null", types)
+			}
+			port, _ := properties["port"].(map[string]any)
+			if _, ok := port["anyOf"]; !ok {
+				t.Errorf("int-or-string port = %v, want an integer or string choice", port)
+			}
+
+			// A second lookup is served from memory and the cache
+			if _, err := source.SchemaURI(t.Context(), "example.com", "v1", "Widget", tt.strict); err != nil {
+				t.Fatalf("SchemaURI() error = %v", err)
+			}
+			if got := server.count("/openapi/v3"); got != 1 {
+				t.Errorf("index fetched %d times, want 1", got)
+			}
+			if got := server.count("/openapi/v3/apis/example.com/v1"); got != 1 {
+				t.Errorf("document fetched %d times, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSourceSchemaURINotServed(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		version string
+		kind    string
+	}{
+		{name: "unknown group version", group: "other.example.com", version: "v1", kind: "Widget"},
+		{name: "unknown kind", group: "example.com", version: "v1", kind: "Gadget"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAPIServer(t)
+			source := newTestSource(t, newTestConfig(t, server.URL))
+
+			_, err := source.SchemaURI(t.Context(), tt.group, tt.version, tt.kind, true)
+			if !errors.Is(err, cluster.ErrNotFound) {
+				t.Errorf("SchemaURI() error = %v, want %v", err, cluster.ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestSourceOfflineFallback(t *testing.T) {
+	server := newFakeAPIServer(t)
+	cfg := newTestConfig(t, server.URL)
+
+	online, err := newTestSource(t, cfg).SchemaURI(t.Context(), "example.com", "v1", "Widget", true)
+	if err != nil {
+		t.Fatalf("SchemaURI() error = %v", err)
+	}
+
+	// A new process finds the cluster unreachable and uses the snapshot
+	server.Close()
+	cfg.Cluster.RefreshInterval = 0
+	offline := newTestSource(t, cfg)
+
+	uri, err := offline.SchemaURI(t.Context(), "example.com", "v1", "Widget", true)
+	if err != nil {
+		t.Fatalf("SchemaURI() without cluster error = %v", err)
+	}
+	if uri != online {
+		t.Errorf("SchemaURI() without cluster = %q, want the snapshot %q", uri, online)
+	}
+
+	// Kinds missing from the snapshot are not found without asking the cluster
+	_, err = offline.SchemaURI(t.Context(), "example.com", "v1", "Gadget", true)
+	if !errors.Is(err, cluster.ErrNotFound) {
+		t.Errorf("SchemaURI() of a kind missing from the snapshot error = %v, want %v", err, cluster.ErrNotFound)
+	}
+}
+
+func TestSourceOfflineWithoutSnapshot(t *testing.T) {
+	server := newFakeAPIServer(t)
+	cfg := newTestConfig(t, server.URL)
+	server.Close()
+
+	source := newTestSource(t, cfg)
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	if _, err := source.SchemaURI(ctx, "example.com", "v1", "Widget", true); err == nil {
+		t.Fatal("SchemaURI() without cluster and snapshot succeeded, want an error")
+	}
+	// The cluster is not asked again until the retry backoff expires
+	_, err := source.SchemaURI(ctx, "example.com", "v1", "Widget", true)
+	if err == nil || !strings.Contains(err.Error(), "retrying after") {
+		t.Errorf("SchemaURI() during backoff error = %v, want the retry time", err)
+	}
+}
@@ -0,0 +1,331 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	// UserConfigFileName is the name of the user-level configuration file inside
+	// ~/.config/yaml-schema-router/.
+	UserConfigFileName = "config.yaml"
+
+	// ProjectConfigFileName is the name of the project-level configuration file
+	// looked up in the workspace root reported by the editor.
+	ProjectConfigFileName = ".yaml-schema-router.yaml"
+)
+
+// Config holds every tunable setting of the router.
+type Config struct {
+	// LSPPath is the yaml-language-server executable to spawn.
+	LSPPath string `yaml:"lspPath"`
+
+	// LSPArgs are the arguments passed to the language server.
+	LSPArgs []string `yaml:"lspArgs"`
+
+	// LogFile is the path logs are written to. Empty logs to stderr.
+	LogFile string `yaml:"logFile"`
+
+	// LogLevel is one of LogLevelDebug, LogLevelInfo or LogLevelOff.
+	LogLevel string `yaml:"logLevel"`
+
+	Kubernetes KubernetesConfig `yaml:"kubernetes"`
+	CRD        CRDConfig        `yaml:"crd"`
+	Cluster    ClusterConfig    `yaml:"cluster"`
+	Registry   RegistryConfig   `yaml:"registry"`
+	Detection  DetectionConfig  `yaml:"detection"`
+	Schemas    SchemasConfig    `yaml:"schemas"`
+	Features   FeatureConfig    `yaml:"features"`
+
+	// WorkspaceRoot is the directory the project layer was loaded from, if any.
+	WorkspaceRoot string `yaml:"-"`
+}
+
+// KubernetesConfig configures the built-in Kubernetes schema lookup.
+type KubernetesConfig struct {
+	// SchemaRegistry is the primary source of built-in schemas: either the
+	// base URL of a kubernetes-json-schema style registry or a URL template
+	// with placeholders such as {kubernetesVersion}, {flavour}, {kind} and
+	// {groupVersion}. file:// URLs read schemas from a directory.
+	SchemaRegistry string `yaml:"schemaRegistry"`
+
+	// Mirrors are tried in order before SchemaRegistry and take the same
+	// kind of URLs.
+	Mirrors []string `yaml:"mirrors"`
+
+	// Version is the Kubernetes version used unless a file selects another one
+	// through a modeline, a version marker or a Helm chart. "1.29" and
+	// "v1.29.0" are equivalent.
+	Version string `yaml:"version"`
+
+	// Flavour is one of FlavourStrict, FlavourStandalone or FlavourNonStrict.
+	// The registry directory suffixes ("-standalone-strict", "-standalone" and
+	// "") are accepted as well.
+	Flavour string `yaml:"flavour"`
+
+	// FlavourOverrides select another flavour for the files matching their
+	// pattern. The first matching override wins.
+	FlavourOverrides []FlavourOverride `yaml:"flavourOverrides"`
+}
+
+// FlavourOverride applies a schema flavour to the files matching a glob
+// pattern, written like the patterns of the editor's yaml.schemas setting.
+type FlavourOverride struct {
+	Pattern string `yaml:"pattern"`
+	Flavour string `yaml:"flavour"`
+}
+
+// CRDConfig configures the Custom Resource Definition schema lookup.
+type CRDConfig struct {
+	// SchemaRegistry is the primary source of CRD schemas: either the base
+	// URL of a CRDs-catalog style registry or a URL template with
+	// placeholders such as {group}, {kind} and {version}. file:// URLs read
+	// schemas from a directory.
+	SchemaRegistry string `yaml:"schemaRegistry"`
+
+	// Mirrors are tried in order before SchemaRegistry and take the same
+	// kind of URLs.
+	Mirrors []string `yaml:"mirrors"`
+
+	// LocalDirs are scanned for CustomResourceDefinition manifests in
+	// addition to the workspace root. Relative paths are resolved against the
+	// workspace root.
+	LocalDirs []string `yaml:"localDirs"`
+}
+
+// ClusterConfig configures reading schemas from the OpenAPI v3 endpoint of a
+// Kubernetes API server.
+type ClusterConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Kubeconfig is the kubeconfig file to read. Empty uses $KUBECONFIG or
+	// ~/.kube/config.
+	Kubeconfig string `yaml:"kubeconfig"`
+
+	// Context is the kubeconfig context to use. Empty uses the current context.
+	Context string `yaml:"context"`
+
+	// RefreshInterval is how long the OpenAPI snapshot of the cluster is used
+	// before the API server is asked for changes.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// RegistryConfig configures how schemas are fetched and cached.
+type RegistryConfig struct {
+	DownloadTimeout time.Duration `yaml:"downloadTimeout"`
+
+	// RetryBackoff is the initial delay before retrying a download that failed.
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+
+	// NotFoundBackoff is the initial delay before retrying a schema the server
+	// reported as missing.
+	NotFoundBackoff time.Duration `yaml:"notFoundBackoff"`
+
+	// MaxRetryBackoff caps the delay, which doubles with every consecutive failure.
+	MaxRetryBackoff time.Duration `yaml:"maxRetryBackoff"`
+
+	// MaxSchemaSize is the largest download, in bytes, accepted as a schema.
+	MaxSchemaSize int `yaml:"maxSchemaSize"`
+
+	// Packs are schema pack archives serving schemas that can't be
+	// downloaded, tried in order before the pack embedded in the binary.
+	Packs []string `yaml:"packs"`
+
+	// MaxAge is how long a downloaded schema is used before it is revalidated
+	// with its source in the background. Zero never revalidates.
+	MaxAge time.Duration `yaml:"maxAge"`
+}
+
+// DetectionConfig tunes when documents are analyzed.
+type DetectionConfig struct {
+	// Debounce is how long a document must stay unchanged before it is re-detected.
+	Debounce time.Duration `yaml:"debounce"`
+
+	// RecentCacheSize is how many detection results are kept for reopened
+	// documents. Zero disables the cache.
+	RecentCacheSize int `yaml:"recentCacheSize"`
+}
+
+// SchemasConfig controls how router mappings are combined with the
+// yaml.schemas setting configured in the editor.
+type SchemasConfig struct {
+	// ConflictPolicy is one of SchemaPolicyMerge, SchemaPolicyUser or SchemaPolicyRouter.
+	ConflictPolicy string `yaml:"conflictPolicy"`
+}
+
+// FeatureConfig holds the yaml-language-server features that are enabled
+// unless the editor configures them explicitly.
+type FeatureConfig struct {
+	Hover      bool `yaml:"hover"`
+	Completion bool `yaml:"completion"`
+	Validation bool `yaml:"validation"`
+}
+
+// Default returns a Config populated with the built-in defaults.
+func Default() *Config {
+	return &Config{
+		LSPPath:  DefaultLSPPath,
+		LSPArgs:  []string{"--stdio"},
+		LogFile:  defaultLogFile(),
+		LogLevel: DefaultLogLevel,
+		Kubernetes: KubernetesConfig{
+			SchemaRegistry: DefaultK8sSchemaRegistry,
+			Version:        DefaultK8sSchemaVersion,
+			Flavour:        DefaultK8sSchemaFlavour,
+		},
+		CRD: CRDConfig{
+			SchemaRegistry: DefaultCRDSchemaRegistry,
+		},
+		Cluster: ClusterConfig{
+			RefreshInterval: DefaultClusterRefreshInterval,
+		},
+		Registry: RegistryConfig{
+			DownloadTimeout: DefaultDownloaderTimeout,
+			RetryBackoff:    DefaultRetryBackoff,
+			NotFoundBackoff: DefaultNotFoundBackoff,
+			MaxRetryBackoff: DefaultMaxRetryBackoff,
+			MaxSchemaSize:   DefaultMaxSchemaSize,
+			MaxAge:          DefaultSchemaMaxAge,
+		},
+		Detection: DetectionConfig{
+			Debounce:        DefaultDetectionDebounce,
+			RecentCacheSize: DefaultRecentCacheSize,
+		},
+		Schemas: SchemasConfig{
+			ConflictPolicy: DefaultSchemaConflictPolicy,
+		},
+		Features: FeatureConfig{
+			Hover:      DefaultHover,
+			Completion: DefaultCompletion,
+			Validation: DefaultValidation,
+		},
+	}
+}
+
+// UserConfigDir returns ~/.config/yaml-schema-router.
+func UserConfigDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", DefaultConfigDirName), nil
+}
+
+// defaultLogFile places the log next to the user configuration, falling back
+// to the temp directory when the home directory is unknown.
+func defaultLogFile() string {
+	dir, err := UserConfigDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "yaml-schema-router.log")
+	}
+	return filepath.Join(dir, "router.log")
+}
+
+// Loader builds the effective configuration from its layers. Precedence is
+// flags > environment > project > user > defaults.
+type Loader struct {
+	userFile  string
+	lookupEnv func(string) (string, bool)
+	overrides func(*Config)
+}
+
+// NewLoader creates a Loader reading the user-level file from its default
+// location. The overrides callback is applied last and is meant to copy
+// explicitly set command-line flags onto the configuration.
+func NewLoader(overrides func(*Config)) *Loader {
+	userFile := ""
+	if dir, err := UserConfigDir(); err == nil {
+		userFile = filepath.Join(dir, UserConfigFileName)
+	}
+
+	return &Loader{userFile: userFile, lookupEnv: os.LookupEnv, overrides: overrides}
+}
+
+// Load merges all layers. An empty workspaceRoot skips the project layer.
+func (l *Loader) Load(workspaceRoot string) (*Config, error) {
+	return l.load(workspaceRoot, nil)
+}
+
+// load merges all layers, calling observe, if not nil, after each layer
+// with the configuration so far and the name of the layer.
+func (l *Loader) load(workspaceRoot string, observe func(cfg *Config, source string)) (*Config, error) {
+	if observe == nil {
+		observe = func(*Config, string) {}
+	}
+
+	cfg := Default()
+	observe(cfg, SourceDefault)
+
+	if err := mergeFile(cfg, l.userFile); err != nil {
+		return nil, err
+	}
+	observe(cfg, l.userFile)
+
+	if workspaceRoot != "" {
+		projectFile := filepath.Join(workspaceRoot, ProjectConfigFileName)
+		if err := mergeProjectFile(cfg, projectFile); err != nil {
+			return nil, err
+		}
+		cfg.WorkspaceRoot = workspaceRoot
+		observe(cfg, projectFile)
+	}
+
+	if err := applyEnv(cfg, l.lookupEnv, func(name string) { observe(cfg, name) }); err != nil {
+		return nil, err
+	}
+
+	if l.overrides != nil {
+		l.overrides(cfg)
+		observe(cfg, SourceFlags)
+	}
+
+	return cfg, nil
+}
+
+// mergeFile decodes a YAML file on top of cfg. Keys absent from the file keep
+// their current value. A missing file is not an error.
+func mergeFile(cfg *Config, path string) error {
+	data, err := readFile(path)
+	if err != nil || data == nil {
+		return err
+	}
+
+	return decodeFile(cfg, data, path)
+}
+
+// readFile returns the content of a configuration file, or nil if there is
+// none.
+func readFile(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path) //nolint:gosec // the path is a well-known config location
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+
+	return data, nil
+}
+
+// decodeFile decodes the content of the configuration file at path on top of
+// cfg, rejecting unknown keys.
+func decodeFile(cfg *Config, data []byte, path string) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -17,20 +17,54 @@ const (
 	// DefaultConfigDirName is the folder name inside ~/.config/.
 	DefaultConfigDirName = "yaml-schema-router"
 
+	// DefaultLSPPath is the yaml-language-server executable looked up in the system PATH.
+	DefaultLSPPath = "yaml-language-server"
+
+	// LogLevelDebug logs everything and annotates each line with its source location.
+	LogLevelDebug = "debug"
+
+	// LogLevelInfo logs routing decisions, cache activity and errors.
+	LogLevelInfo = "info"
+
+	// LogLevelOff disables logging entirely.
+	LogLevelOff = "off"
+
+	// DefaultLogLevel is the log level used unless configured otherwise.
+	DefaultLogLevel = LogLevelInfo
+
 	// DefaultK8sSchemaRegistry is the url to fetch k8s schmeas from.
 	DefaultK8sSchemaRegistry = "https://raw.githubusercontent.com/yannh/kubernetes-json-schema/master"
 
 	// DefaultK8sSchemaVersion is the version of the k8s schmeas to fetch.
 	DefaultK8sSchemaVersion = "v1.33.0"
 
-	// DefaultK8sSchemaFlavour is the "-standalone-strict" suffix for self-contained, strict validation.
-	DefaultK8sSchemaFlavour = "-standalone-strict"
+	// FlavourStrict selects self-contained schemas that reject unknown fields.
+	FlavourStrict = "strict"
+
+	// FlavourStandalone selects self-contained schemas that allow unknown fields.
+	FlavourStandalone = "standalone"
+
+	// FlavourNonStrict selects the upstream schemas referencing a shared
+	// _definitions.json, which allow unknown fields.
+	FlavourNonStrict = "non-strict"
+
+	// DefaultK8sSchemaFlavour is the flavour used unless configured otherwise.
+	DefaultK8sSchemaFlavour = FlavourStrict
 
 	// DefaultCRDSchemaRegistry is the url to fetch crd schmas from.
 	DefaultCRDSchemaRegistry = "https://raw.githubusercontent.com/datreeio/CRDs-catalog/main"
 
-	// DefaultK8sMetaSchemaFileName is the filename of the Kubernetes ObjectMeta schema.
-	DefaultK8sMetaSchemaFileName = "objectmeta-meta-v1.json"
+	// SchemaPolicyMerge keeps both the user's yaml.schemas patterns and the router's mappings.
+	SchemaPolicyMerge = "merge"
+
+	// SchemaPolicyUser skips router mappings for files already matched by a user pattern.
+	SchemaPolicyUser = "user"
+
+	// SchemaPolicyRouter drops user patterns that match a file the router has mapped.
+	SchemaPolicyRouter = "router"
+
+	// DefaultSchemaConflictPolicy is the policy used unless configured otherwise.
+	DefaultSchemaConflictPolicy = SchemaPolicyMerge
 
 	// DefaultHover determines if hover support is enabled by default.
 	DefaultHover = true
@@ -43,4 +77,28 @@ const (
 
 	// DefaultDownloaderTimeout is the maximum duration allowed for schema downloads.
 	DefaultDownloaderTimeout = 2 * time.Second
+
+	// DefaultRetryBackoff is the initial delay before retrying a failed schema download.
+	DefaultRetryBackoff = time.Minute
+
+	// DefaultNotFoundBackoff is the initial delay before retrying a schema that does not exist upstream.
+	DefaultNotFoundBackoff = time.Hour
+
+	// DefaultMaxRetryBackoff caps the exponential backoff of failed schema downloads.
+	DefaultMaxRetryBackoff = 24 * time.Hour
+
+	// DefaultMaxSchemaSize is the largest download, in bytes, accepted as a schema.
+	DefaultMaxSchemaSize = 32 << 20
+
+	// DefaultSchemaMaxAge is how long a downloaded schema is used before it is revalidated with its source.
+	DefaultSchemaMaxAge = 24 * time.Hour
+
+	// DefaultClusterRefreshInterval is how long an API server's OpenAPI snapshot is used before refreshing it.
+	DefaultClusterRefreshInterval = 10 * time.Minute
+
+	// DefaultDetectionDebounce is how long a changed document must stay idle before it is re-detected.
+	DefaultDetectionDebounce = 300 * time.Millisecond
+
+	// DefaultRecentCacheSize is how many detection results are kept for reopened documents.
+	DefaultRecentCacheSize = 100
 )
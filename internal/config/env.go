@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix is prepended to every environment variable read by the router.
+const EnvPrefix = "YAML_SCHEMA_ROUTER_"
+
+// envBinding maps one environment variable (without prefix) onto a Config field.
+type envBinding struct {
+	name  string
+	apply func(cfg *Config, value string) error
+}
+
+// envBindings lists every setting that can be configured through the environment.
+var envBindings = []envBinding{
+	{"LSP_PATH", stringVar(func(c *Config) *string { return &c.LSPPath })},
+	{"LSP_ARGS", fieldsVar(func(c *Config) *[]string { return &c.LSPArgs })},
+	{"LOG_FILE", stringVar(func(c *Config) *string { return &c.LogFile })},
+	{"LOG_LEVEL", stringVar(func(c *Config) *string { return &c.LogLevel })},
+	{"K8S_VERSION", stringVar(func(c *Config) *string { return &c.Kubernetes.Version })},
+	{"K8S_FLAVOUR", stringVar(func(c *Config) *string { return &c.Kubernetes.Flavour })},
+	{"K8S_SCHEMA_REGISTRY", stringVar(func(c *Config) *string { return &c.Kubernetes.SchemaRegistry })},
+	{"K8S_SCHEMA_MIRRORS", listVar(func(c *Config) *[]string { return &c.Kubernetes.Mirrors })},
+	{"CRD_SCHEMA_REGISTRY", stringVar(func(c *Config) *string { return &c.CRD.SchemaRegistry })},
+	{"CRD_SCHEMA_MIRRORS", listVar(func(c *Config) *[]string { return &c.CRD.Mirrors })},
+	{"CRD_LOCAL_DIRS", pathListVar(func(c *Config) *[]string { return &c.CRD.LocalDirs })},
+	{"CLUSTER_ENABLED", boolVar(func(c *Config) *bool { return &c.Cluster.Enabled })},
+	{"CLUSTER_KUBECONFIG", stringVar(func(c *Config) *string { return &c.Cluster.Kubeconfig })},
+	{"CLUSTER_CONTEXT", stringVar(func(c *Config) *string { return &c.Cluster.Context })},
+	{"CLUSTER_REFRESH_INTERVAL", durationVar(func(c *Config) *time.Duration { return &c.Cluster.RefreshInterval })},
+	{"DOWNLOAD_TIMEOUT", durationVar(func(c *Config) *time.Duration { return &c.Registry.DownloadTimeout })},
+	{"RETRY_BACKOFF", durationVar(func(c *Config) *time.Duration { return &c.Registry.RetryBackoff })},
+	{"NOT_FOUND_BACKOFF", durationVar(func(c *Config) *time.Duration { return &c.Registry.NotFoundBackoff })},
+	{"MAX_RETRY_BACKOFF", durationVar(func(c *Config) *time.Duration { return &c.Registry.MaxRetryBackoff })},
+	{"MAX_SCHEMA_SIZE", intVar(func(c *Config) *int { return &c.Registry.MaxSchemaSize })},
+	{"SCHEMA_PACKS", pathListVar(func(c *Config) *[]string { return &c.Registry.Packs })},
+	{"SCHEMA_MAX_AGE", durationVar(func(c *Config) *time.Duration { return &c.Registry.MaxAge })},
+	{"DETECTION_DEBOUNCE", durationVar(func(c *Config) *time.Duration { return &c.Detection.Debounce })},
+	{"DETECTION_RECENT_CACHE_SIZE", intVar(func(c *Config) *int { return &c.Detection.RecentCacheSize })},
+	{"SCHEMA_CONFLICT_POLICY", stringVar(func(c *Config) *string { return &c.Schemas.ConflictPolicy })},
+	{"HOVER", boolVar(func(c *Config) *bool { return &c.Features.Hover })},
+	{"COMPLETION", boolVar(func(c *Config) *bool { return &c.Features.Completion })},
+	{"VALIDATION", boolVar(func(c *Config) *bool { return &c.Features.Validation })},
+}
+
+// applyEnv overrides cfg with every YAML_SCHEMA_ROUTER_* variable that lookup
+// reports as set, calling applied with the name of each.
+func applyEnv(cfg *Config, lookup func(string) (string, bool), applied func(name string)) error {
+	for _, binding := range envBindings {
+		name := EnvPrefix + binding.name
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+
+		if err := binding.apply(cfg, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", name, err)
+		}
+		applied(name)
+	}
+
+	return nil
+}
+
+func stringVar(field func(*Config) *string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = value
+		return nil
+	}
+}
+
+// fieldsVar splits the value on whitespace, e.g. "--stdio --log-level debug".
+func fieldsVar(field func(*Config) *[]string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = strings.Fields(value)
+		return nil
+	}
+}
+
+// pathListVar splits the value like PATH, e.g. "crds:vendor/crds" (";" on Windows).
+func pathListVar(field func(*Config) *[]string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = filepath.SplitList(value)
+		return nil
+	}
+}
+
+// listVar splits the value on commas, e.g. "https://a.example,file:///srv/schemas".
+func listVar(field func(*Config) *[]string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		*field(cfg) = items
+		return nil
+	}
+}
+
+func intVar(field func(*Config) *int) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}
+}
+
+func boolVar(field func(*Config) *bool) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}
+}
+
+func durationVar(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = parsed
+		return nil
+	}
+}
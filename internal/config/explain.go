@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const (
+	// SourceDefault is the source of settings nothing overrides.
+	SourceDefault = "default"
+
+	// SourceFlags is the source of settings given on the command line.
+	SourceFlags = "flags"
+)
+
+// Setting is a configuration value and the layer it was taken from.
+type Setting struct {
+	// Key is the dotted path of the setting in the configuration files, e.g.
+	// "kubernetes.version".
+	Key   string
+	Value string
+
+	// Source is SourceDefault, the path of the user or project file, the name
+	// of the environment variable or SourceFlags.
+	Source string
+}
+
+// Explain loads the configuration like Load and returns every setting,
+// sorted by key, with the last layer that changed it.
+func (l *Loader) Explain(workspaceRoot string) (*Config, []Setting, error) {
+	settings := make(map[string]Setting)
+
+	cfg, err := l.load(workspaceRoot, func(cfg *Config, source string) {
+		for key, value := range flatten(cfg) {
+			if current, ok := settings[key]; !ok || current.Value != value {
+				settings[key] = Setting{Key: key, Value: value, Source: source}
+			}
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sorted := make([]Setting, 0, len(settings))
+	for _, setting := range settings {
+		sorted = append(sorted, setting)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+
+	return cfg, sorted, nil
+}
+
+// flatten returns the settings of cfg keyed by their dotted path. Lists are
+// rendered as JSON.
+func flatten(cfg *Config) map[string]string {
+	var node yaml.Node
+	if err := node.Encode(cfg); err != nil {
+		return nil
+	}
+
+	settings := make(map[string]string)
+	flattenNode(&node, nil, settings)
+	return settings
+}
+
+func flattenNode(node *yaml.Node, path []string, settings map[string]string) {
+	key := strings.Join(path, ".")
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			flattenNode(node.Content[i+1], append(path, node.Content[i].Value), settings)
+		}
+	case yaml.ScalarNode:
+		settings[key] = node.Value
+	default:
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		settings[key] = string(data)
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"log"
+
+	"go.yaml.in/yaml/v3"
+)
+
+const componentName = "Config"
+
+// projectKeys are the top-level keys a project configuration may set. The
+// others choose programs to run, credentials to use or files to write, which
+// a repository opened in the editor must not control, so they are only read
+// from the user configuration, the environment and flags.
+var projectKeys = map[string]bool{
+	"kubernetes": true,
+	"crd":        true,
+	"registry":   true,
+	"detection":  true,
+	"schemas":    true,
+	"features":   true,
+}
+
+// userOnlyKeys are the keys below projectKeys a project configuration may not
+// set either. They choose where schemas and CRDs are read from, which would
+// let a repository read local files or route every schema through its server.
+var userOnlyKeys = map[string]bool{
+	"kubernetes.schemaRegistry": true,
+	"kubernetes.mirrors":        true,
+	"crd.schemaRegistry":        true,
+	"crd.mirrors":               true,
+	"crd.localDirs":             true,
+	"registry.packs":            true,
+}
+
+// mergeKey is the YAML merge key, e.g. "<<: *defaults".
+const mergeKey = "<<"
+
+// mergeProjectFile is mergeFile for the project configuration. Keys that are
+// not in projectKeys or are in userOnlyKeys are logged and ignored.
+func mergeProjectFile(cfg *Config, path string) error {
+	data, err := readFile(path)
+	if err != nil || data == nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		// Let the decoder report what is wrong with it
+		return decodeFile(cfg, data, path)
+	}
+
+	mapping := doc.Content[0]
+	filterProjectKeys(mapping, "", path)
+
+	filtered, err := yaml.Marshal(mapping)
+	if err != nil {
+		return fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return decodeFile(cfg, filtered, path)
+}
+
+// filterProjectKeys removes the keys a project configuration may not set from
+// mapping, whose keys are below prefix, e.g. "crd.". Mappings merged in with
+// "<<" below the top level are filtered as well.
+func filterProjectKeys(mapping *yaml.Node, prefix, path string) {
+	allowed := make([]*yaml.Node, 0, len(mapping.Content))
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		name := prefix + key.Value
+
+		switch {
+		case prefix != "" && key.Value == mergeKey:
+			filterMerged(value, prefix, path)
+		case prefix == "" && !projectKeys[name], userOnlyKeys[name]:
+			log.Printf("[%s] Ignoring %q in project configuration %s: it is only read from the user configuration, "+
+				"environment and flags", componentName, name, path)
+			continue
+		case prefix == "":
+			if nested := resolveAlias(value); nested.Kind == yaml.MappingNode {
+				filterProjectKeys(nested, name+".", path)
+			}
+		}
+		allowed = append(allowed, key, value)
+	}
+	mapping.Content = allowed
+}
+
+// filterMerged filters the mappings merged in with "<<", which is either a
+// mapping or a sequence of them.
+func filterMerged(value *yaml.Node, prefix, path string) {
+	value = resolveAlias(value)
+	merged := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		merged = value.Content
+	}
+
+	for _, node := range merged {
+		if node = resolveAlias(node); node.Kind == yaml.MappingNode {
+			filterProjectKeys(node, prefix, path)
+		}
+	}
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// WithProject returns a copy of c with the settings a project configuration
+// may override taken from cfg, leaving those the process was started with
+// untouched.
+func (c *Config) WithProject(cfg *Config) *Config {
+	merged := *c
+	merged.Kubernetes = cfg.Kubernetes
+	merged.CRD = cfg.CRD
+	merged.Registry = cfg.Registry
+	merged.Detection = cfg.Detection
+	merged.Schemas = cfg.Schemas
+	merged.Features = cfg.Features
+	merged.WorkspaceRoot = cfg.WorkspaceRoot
+	return &merged
+}
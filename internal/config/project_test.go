@@ -0,0 +1,99 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+// loadProject loads the configuration of a workspace holding a project
+// configuration with content, without a user configuration.
+func loadProject(t *testing.T, content string) *config.Config {
+	t.Helper()
+
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, config.ProjectConfigFileName), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.NewLoader(nil).Load(root)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return cfg
+}
+
+func TestProjectKeys(t *testing.T) {
+	defaults := config.Default()
+
+	tests := []struct {
+		name    string
+		content string
+		check   func(cfg *config.Config) bool
+	}{
+		{
+			name:    "allowed keys",
+			content: "kubernetes:\n  version: \"1.29\"\ncrd:\n  localDirs: [crds]\n",
+			check: func(cfg *config.Config) bool {
+				return cfg.Kubernetes.Version == "1.29" && len(cfg.CRD.LocalDirs) == 0
+			},
+		},
+		{
+			name:    "programs to run",
+			content: "lspPath: /tmp/evil\nlogFile: /tmp/log\n",
+			check: func(cfg *config.Config) bool {
+				return cfg.LSPPath == defaults.LSPPath && cfg.LogFile != "/tmp/log"
+			},
+		},
+		{
+			name: "schema sources",
+			content: "kubernetes:\n  schemaRegistry: file:///etc\n  mirrors: [https://evil.example.com]\n" +
+				"crd:\n  schemaRegistry: file:///etc\n  mirrors: [https://evil.example.com]\n" +
+				"registry:\n  packs: [/tmp/pack.tar.gz]\n  maxAge: 1h\n",
+			check: func(cfg *config.Config) bool {
+				return reflect.DeepEqual(cfg.Kubernetes, defaults.Kubernetes) &&
+					reflect.DeepEqual(cfg.CRD, defaults.CRD) &&
+					len(cfg.Registry.Packs) == 0 && cfg.Registry.MaxAge.Hours() == 1
+			},
+		},
+		{
+			name: "merged schema sources",
+			content: "crd: &crd\n  schemaRegistry: file:///etc\nkubernetes:\n  <<: [*crd, {mirrors: [file:///etc]}]\n" +
+				"  version: \"1.29\"\n",
+			check: func(cfg *config.Config) bool {
+				return cfg.Kubernetes.SchemaRegistry == defaults.Kubernetes.SchemaRegistry &&
+					len(cfg.Kubernetes.Mirrors) == 0 && cfg.Kubernetes.Version == "1.29"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cfg := loadProject(t, tt.content); !tt.check(cfg) {
+				t.Errorf("project configuration %q applied as %+v", tt.content, cfg)
+			}
+		})
+	}
+}
+
+func TestWithProject(t *testing.T) {
+	started := config.Default()
+	started.LSPPath = "/usr/bin/yaml-language-server"
+
+	project := config.Default()
+	project.LSPPath = "/tmp/evil"
+	project.Kubernetes.Version = "1.29"
+	project.WorkspaceRoot = "/work"
+
+	merged := started.WithProject(project)
+	if merged.LSPPath != started.LSPPath || merged.Kubernetes.Version != "1.29" || merged.WorkspaceRoot != "/work" {
+		t.Errorf("WithProject() = %+v, want the started LSP path with the project settings", merged)
+	}
+	if started.Kubernetes.Version == "1.29" || started.WorkspaceRoot != "" {
+		t.Error("WithProject() changed the configuration it was called on")
+	}
+}
@@ -1,14 +1,67 @@
 // Package detector defines the core interface and evaluation chain for identifying file schemas.
 package detector
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"log"
+)
 
 // Detector defines the contract for all schema detectors.
 type Detector interface {
 	Name() string
-	Detect(uri string, content []byte) (schemaURLs []string, err error)
+	Detect(ctx context.Context, uri string, content []byte) (matches []Match, err error)
 }
 
+// FileObserver is implemented by detectors that index files on disk and need
+// to hear about the files the editor opens or saves.
+type FileObserver interface {
+	FileChanged(uri string)
+}
+
+// Match is a schema a detector claimed for (part of) a file.
+type Match struct {
+	// SchemaURI is the URI of the schema, usually a file:// URI into the cache.
+	SchemaURI string
+
+	// Discriminator holds the top-level property values identifying the
+	// documents of a multi-document file this schema applies to, such as
+	// apiVersion and kind. An empty discriminator applies to every document.
+	Discriminator map[string]string
+
+	// StartLine and EndLine are the 1-based, inclusive lines of the document
+	// the schema was detected in. They are zero for matches of the whole file.
+	StartLine int
+	EndLine   int
+
+	// Detector is the name of the detector that claimed the schema. Chain.Run
+	// fills it in.
+	Detector string
+}
+
+// UnresolvedError is returned by a detector, together with the matches it
+// did resolve, for a document it recognized but could not get the schema
+// of, e.g. while offline.
+type UnresolvedError struct {
+	// Subject describes the document, e.g. "apps/v1 Deployment".
+	Subject string
+
+	// StartLine and EndLine are the 1-based, inclusive lines of the document.
+	StartLine int
+	EndLine   int
+
+	// Detector is the name of the detector. Chain.RunAll fills it in.
+	Detector string
+
+	Err error
+}
+
+func (e *UnresolvedError) Error() string {
+	return fmt.Sprintf("line %d: could not resolve the schema of %s: %v", e.StartLine, e.Subject, e.Err)
+}
+
+func (e *UnresolvedError) Unwrap() error { return e.Err }
+
 // Chain manages a sequence of Detectors.
 type Chain struct {
 	detectors []Detector
@@ -22,20 +75,73 @@ func NewChain(detectors ...Detector) *Chain {
 }
 
 // Run iterates through all detectors and aggregates every claimed file schema.
-func (c *Chain) Run(uri string, content []byte) (schemaURLs []string, err error) {
-	var allURLs []string
+// It stops early and returns the context's error once ctx is canceled.
+// Documents whose schema could not be resolved are logged and skipped.
+func (c *Chain) Run(ctx context.Context, uri string, content []byte) (matches []Match, err error) {
+	matches, _, err = c.RunAll(ctx, uri, content)
+	return matches, err
+}
 
+// RunAll is like Run, but also returns the documents that detectors
+// recognized but could not get the schema of.
+func (c *Chain) RunAll(
+	ctx context.Context,
+	uri string,
+	content []byte,
+) (matches []Match, unresolved []*UnresolvedError, err error) {
 	for _, d := range c.detectors {
-		urls, err := d.Detect(uri, content)
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		found, err := d.Detect(ctx, uri, content)
 		if err != nil {
 			log.Printf("[%s] Error during detection: %v", d.Name(), err)
-			continue
+
+			failed := unresolvedErrors(err)
+			if len(failed) == 0 {
+				continue
+			}
+			for _, u := range failed {
+				u.Detector = d.Name()
+			}
+			unresolved = append(unresolved, failed...)
+		}
+
+		for _, match := range found {
+			match.Detector = d.Name()
+			matches = append(matches, match)
 		}
+	}
+
+	return matches, unresolved, nil
+}
 
-		if len(urls) > 0 {
-			allURLs = append(allURLs, urls...)
+// unresolvedErrors returns the UnresolvedErrors err holds. errors.As only
+// finds the first one, so the tree is walked by hand.
+func unresolvedErrors(err error) []*UnresolvedError {
+	switch e := err.(type) {
+	case *UnresolvedError:
+		return []*UnresolvedError{e}
+	case interface{ Unwrap() []error }:
+		var all []*UnresolvedError
+		for _, inner := range e.Unwrap() {
+			all = append(all, unresolvedErrors(inner)...)
 		}
+		return all
+	case interface{ Unwrap() error }:
+		return unresolvedErrors(e.Unwrap())
+	default:
+		return nil
 	}
+}
 
-	return allURLs, nil
+// FileChanged tells the detectors implementing FileObserver that the file at
+// uri was opened or saved.
+func (c *Chain) FileChanged(uri string) {
+	for _, d := range c.detectors {
+		if observer, ok := d.(FileObserver); ok {
+			observer.FileChanged(uri)
+		}
+	}
 }
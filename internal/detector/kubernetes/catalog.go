@@ -0,0 +1,79 @@
+package kubernetes
+
+import (
+	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const (
+	// builtinLayout is the file layout of kubernetes-json-schema, e.g.
+	// "v1.29.0-standalone-strict/deployment-apps-v1.json".
+	builtinLayout = "{kubernetesVersion}{flavour}/{kind}-{groupVersion}.json"
+
+	// crdLayout is the file layout of the CRDs-catalog, e.g.
+	// "cert-manager.io/certificate_v1.json".
+	crdLayout = "{group}/{kind}_{version}.json"
+)
+
+// builtinCatalog returns the sources of the built-in Kubernetes schemas.
+func builtinCatalog(cfg *config.Config) schemaregistry.Catalog {
+	return schemaregistry.NewCatalog(K8sDetectorName, builtinLayout, cfg.Kubernetes.Mirrors, cfg.Kubernetes.SchemaRegistry)
+}
+
+// crdCatalog returns the sources of the CRD schemas.
+func crdCatalog(cfg *config.Config) schemaregistry.Catalog {
+	return schemaregistry.NewCatalog(CRDDetectorName, crdLayout, cfg.CRD.Mirrors, cfg.CRD.SchemaRegistry)
+}
+
+// schemaTarget is the Kubernetes version and flavour the schemas of a file
+// are picked for.
+type schemaTarget struct {
+	// Version is the Kubernetes version, e.g. "v1.29.0".
+	Version string
+
+	// Flavour is the registry directory suffix, e.g. "-standalone-strict".
+	Flavour string
+}
+
+// resolveSchemaTarget returns the Kubernetes version and flavour of a file.
+func resolveSchemaTarget(cfg *config.Config, uri string, content []byte) schemaTarget {
+	return schemaTarget{
+		Version: kubernetesVersion(cfg, uri, content),
+		Flavour: kubernetesFlavour(cfg, uri, content),
+	}
+}
+
+// dir returns the registry directory of the target, e.g.
+// "v1.29.0-standalone-strict".
+func (t schemaTarget) dir() string {
+	return t.Version + t.Flavour
+}
+
+// strict reports whether the target's schemas reject unknown fields.
+func (t schemaTarget) strict() bool {
+	return strings.HasSuffix(t.Flavour, "-strict")
+}
+
+// standalone reports whether the target's schemas are self-contained rather
+// than referencing a shared _definitions.json.
+func (t schemaTarget) standalone() bool {
+	return strings.Contains(t.Flavour, "-standalone")
+}
+
+// ref returns the schema reference of a kind for the target.
+func (t schemaTarget) ref(group, version, kind string) schemaregistry.SchemaRef {
+	return schemaregistry.SchemaRef{
+		Group:             group,
+		Version:           version,
+		Kind:              kind,
+		KubernetesVersion: t.Version,
+		Flavour:           t.Flavour,
+	}
+}
+
+// objectMetaRef returns the reference of the ObjectMeta schema for the target.
+func (t schemaTarget) objectMetaRef() schemaregistry.SchemaRef {
+	return t.ref("meta", "v1", "ObjectMeta")
+}
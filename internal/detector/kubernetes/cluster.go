@@ -0,0 +1,33 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.trai.ch/yaml-schema-router/internal/cluster"
+)
+
+// clusterSchemaURI looks a kind up in the API server, if one is configured.
+// Kinds the cluster doesn't serve are left to the other sources silently.
+func clusterSchemaURI(
+	ctx context.Context,
+	source *cluster.Source,
+	meta typeMeta,
+	group, version string,
+	target schemaTarget,
+) (string, bool) {
+	if source == nil || !source.Enabled() {
+		return "", false
+	}
+
+	localURI, err := source.SchemaURI(ctx, group, version, meta.Kind, target.strict())
+	if err != nil {
+		if !errors.Is(err, cluster.ErrNotFound) && ctx.Err() == nil {
+			log.Printf("[%s] Failed to read schema for %s from the cluster: %v", K8sDetectorName, meta.Kind, err)
+		}
+		return "", false
+	}
+
+	return localURI, true
+}
@@ -1,14 +1,17 @@
 package kubernetes
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
 
+	"go.trai.ch/yaml-schema-router/internal/cluster"
 	"go.trai.ch/yaml-schema-router/internal/config"
 	"go.trai.ch/yaml-schema-router/internal/detector"
 	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
@@ -33,99 +36,201 @@ type schemaWrapper struct {
 // CRDDetector implements the detector.Detector interface for Kubernetes CRDs.
 type CRDDetector struct {
 	Registry *schemaregistry.Registry
+	Config   *config.Config
+	Groups   *GroupIndex
+
+	// Local, if set, provides schemas from CRD manifests on disk, which take
+	// precedence over the remote catalog.
+	Local *LocalCRDIndex
+
+	// Cluster, if set and enabled, provides schemas from the API server,
+	// which take precedence over the remote catalog.
+	Cluster *cluster.Source
 }
 
-var _ detector.Detector = (*CRDDetector)(nil)
+var (
+	_ detector.Detector     = (*CRDDetector)(nil)
+	_ detector.FileObserver = (*CRDDetector)(nil)
+)
 
 // CRDDetectorName is the unique identifier for the built-in Kubernetes detector.
 const CRDDetectorName = "kubernetes-crd"
 
+// localCRDDirName is the cache directory of schemas generated from CRD
+// manifests on disk.
+const localCRDDirName = schemaregistry.LocalCRDDir
+
 // Name returns the unique string identifier for the CRD detector.
 func (d *CRDDetector) Name() string {
 	return CRDDetectorName
 }
 
+// FileChanged re-reads CRD manifests the editor opened or saved.
+func (d *CRDDetector) FileChanged(uri string) {
+	if d.Local != nil {
+		d.Local.FileChanged(uri)
+	}
+}
+
 // Detect inspects the YAML content for apiVersions containing custom groups
 // and constructs wrapped JSON schemas that include standard ObjectMeta.
-func (d *CRDDetector) Detect(_ string, content []byte) ([]string, error) {
+func (d *CRDDetector) Detect(ctx context.Context, uri string, content []byte) ([]detector.Match, error) {
 	metas := extractAllTypeMeta(content)
 	if len(metas) == 0 {
 		return nil, nil
 	}
 
-	schemaURLs := make([]string, 0, len(metas))
+	// Wrappers embed the ObjectMeta of one Kubernetes version, so they are
+	// cached per version.
+	target := resolveSchemaTarget(d.Config, uri, content)
+	matches := make([]detector.Match, 0, len(metas))
+	var unresolved []error
 
 	for _, meta := range metas {
 		group, version, found := strings.Cut(meta.APIVersion, "/")
-		if !found || (!strings.Contains(group, ".") || strings.HasSuffix(group, "k8s.io")) {
+		if !found || d.Groups.IsBuiltin(ctx, target.Version, group) {
 			continue // Not a CRD, let the builtin detector handle it
 		}
 
 		log.Printf("[%s] Detected Custom Resource: %s/%s", d.Name(), group, meta.Kind)
 
-		kindFormatted := strings.ToLower(meta.Kind)
-		fileName := fmt.Sprintf("%s_%s.json", kindFormatted, version)
-		wrapperCachePath := filepath.Join(CRDDetectorName, group, fmt.Sprintf("%s_%s_wrapper.json", kindFormatted, version))
-
-		// Fast path: if the wrapper already exists, we don't need to do anything
-		if _, statErr := os.Stat(d.Registry.GetLocalPath(wrapperCachePath)); statErr == nil {
-			log.Printf("[%s] Wrapper cache hit for %s", d.Name(), wrapperCachePath)
-			schemaURLs = append(schemaURLs, d.Registry.GetLocalFileURI(wrapperCachePath))
+		fileURI, err := d.resolveSchemaURL(ctx, meta, group, version, target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			unresolved = append(unresolved, meta.unresolved(err))
 			continue
 		}
+		matches = append(matches, meta.match(fileURI))
+	}
 
-		log.Printf("[%s] Wrapper cache miss. Fetching dependencies...", d.Name())
+	return matches, errors.Join(unresolved...)
+}
 
-		localBaseCRDURI, localObjectMetaURI, err := d.fetchDependencies(group, fileName)
-		if err != nil {
-			log.Printf("[%s] Failed to fetch dependencies for CRD %s: %v", d.Name(), meta.Kind, err)
-			continue
+// resolveSchemaURL returns the wrapper schema of a custom resource, building
+// it on first use.
+func (d *CRDDetector) resolveSchemaURL(
+	ctx context.Context,
+	meta typeMeta,
+	group, version string,
+	target schemaTarget,
+) (string, error) {
+	if d.Local != nil {
+		if crd, ok := d.Local.lookup(ctx, group, version, meta.Kind); ok {
+			return d.resolveLocalSchemaURL(ctx, meta, crd, group, version, target)
 		}
+	}
 
-		// Generate and save the wrapper schema
-		fileURI, err := d.generateAndSaveWrapper(localBaseCRDURI, localObjectMetaURI, wrapperCachePath)
-		if err != nil {
-			log.Printf("[%s] Failed to generate wrapper for CRD %s: %v", d.Name(), meta.Kind, err)
-			continue
-		}
+	if localURI, ok := clusterSchemaURI(ctx, d.Cluster, meta, group, version, target); ok {
+		return localURI, nil
+	}
+
+	wrapperName := fmt.Sprintf("%s_%s%s", strings.ToLower(meta.Kind), version, schemaregistry.WrapperSuffix)
+	wrapperCachePath := filepath.Join(CRDDetectorName, group, target.dir(), wrapperName)
 
-		schemaURLs = append(schemaURLs, fileURI)
+	// Fast path: if the wrapper already exists, we don't need to do anything
+	if localURI, ok := d.Registry.CachedFileURI(wrapperCachePath); ok {
+		log.Printf("[%s] Wrapper cache hit for %s", d.Name(), wrapperCachePath)
+		return localURI, nil
 	}
 
-	return schemaURLs, nil
+	log.Printf("[%s] Wrapper cache miss. Fetching dependencies...", d.Name())
+
+	localBaseCRDURI, localObjectMetaURI, err := d.fetchDependencies(ctx, target.ref(group, version, meta.Kind), target)
+	if err != nil {
+		log.Printf("[%s] Failed to fetch dependencies for CRD %s: %v", d.Name(), meta.Kind, err)
+		return "", err
+	}
+
+	// Generate and save the wrapper schema
+	fileURI, err := d.generateAndSaveWrapper(localBaseCRDURI, localObjectMetaURI, wrapperCachePath)
+	if err != nil {
+		log.Printf("[%s] Failed to generate wrapper for CRD %s: %v", d.Name(), meta.Kind, err)
+		return "", err
+	}
+
+	return fileURI, nil
 }
 
 func (d *CRDDetector) fetchDependencies(
-	group, fileName string,
+	ctx context.Context,
+	ref schemaregistry.SchemaRef,
+	target schemaTarget,
 ) (localBaseCRDURI, localObjectMetaURI string, err error) {
-	// Get base CRD remote URL & fetch local URI
-	baseCRDURL, err := url.JoinPath(
-		config.DefaultCRDSchemaRegistry,
-		group,
-		fileName,
-	)
+	localBaseCRDURI, err = d.Registry.Lookup(ctx, crdCatalog(d.Config), ref)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch base CRD schema: %w", err)
+	}
+
+	localObjectMetaURI, err = d.fetchObjectMeta(ctx, target)
 	if err != nil {
 		return "", "", err
 	}
-	baseCRDCachePath := filepath.Join(d.Name(), group, fileName)
-	localBaseCRDURI, err = d.Registry.GetSchemaURI(baseCRDURL, baseCRDCachePath)
+
+	return localBaseCRDURI, localObjectMetaURI, nil
+}
+
+// fetchObjectMeta returns the local URI of the ObjectMeta schema of a
+// Kubernetes version and flavour.
+func (d *CRDDetector) fetchObjectMeta(ctx context.Context, target schemaTarget) (string, error) {
+	localObjectMetaURI, err := d.Registry.Lookup(ctx, builtinCatalog(d.Config), target.objectMetaRef())
 	if err != nil {
-		return "", "", fmt.Errorf("failed to fetch base CRD schema: %w", err)
+		return "", fmt.Errorf("failed to fetch ObjectMeta schema: %w", err)
+	}
+
+	if err := ensureDefinitions(ctx, d.Registry, d.Config, target); err != nil {
+		return "", err
+	}
+
+	return localObjectMetaURI, nil
+}
+
+// resolveLocalSchemaURL returns the wrapper schema of a custom resource whose
+// CRD was found on disk. Generated files are named after a hash of the
+// converted schema, so editing the CRD yields a new schema URI.
+func (d *CRDDetector) resolveLocalSchemaURL(
+	ctx context.Context,
+	meta typeMeta,
+	crd *localCRD,
+	group, version string,
+	target schemaTarget,
+) (string, error) {
+	log.Printf("[%s] Using local CRD from %s for %s/%s", d.Name(), crd.Path, group, meta.Kind)
+
+	schemaBytes, err := json.MarshalIndent(openAPIToJSONSchema(crd.Schema, target.strict()), "", "  ")
+	if err != nil {
+		log.Printf("[%s] Failed to convert local CRD %s: %v", d.Name(), crd.Path, err)
+		return "", err
 	}
 
-	// Get ObjectMeta remote URL & fetch local URI
-	versionDir := fmt.Sprintf("%s%s", config.DefaultK8sSchemaVersion, config.DefaultK8sSchemaFlavour)
-	objectMetaURL, err := url.JoinPath(config.DefaultK8sSchemaRegistry, versionDir, config.DefaultK8sMetaSchemaFileName)
+	sum := sha256.Sum256(schemaBytes)
+	baseName := fmt.Sprintf("%s_%s_%s", strings.ToLower(meta.Kind), version, hex.EncodeToString(sum[:])[:16])
+	wrapperCachePath := filepath.Join(localCRDDirName, group, target.dir(), baseName+schemaregistry.WrapperSuffix)
+
+	if localURI, ok := d.Registry.CachedFileURI(wrapperCachePath); ok {
+		return localURI, nil
+	}
+
+	baseCachePath := filepath.Join(localCRDDirName, group, baseName+".json")
+	if err := d.Registry.SaveLocalSchema(baseCachePath, schemaBytes); err != nil {
+		log.Printf("[%s] Failed to save local CRD schema %s: %v", d.Name(), baseCachePath, err)
+		return "", err
+	}
+
+	localObjectMetaURI, err := d.fetchObjectMeta(ctx, target)
 	if err != nil {
-		return "", "", err
+		log.Printf("[%s] Failed to fetch dependencies for CRD %s: %v", d.Name(), meta.Kind, err)
+		return "", err
 	}
-	metaCachePath := filepath.Join(K8sDetectorName, versionDir, config.DefaultK8sMetaSchemaFileName)
-	localObjectMetaURI, err = d.Registry.GetSchemaURI(objectMetaURL, metaCachePath)
+
+	fileURI, err := d.generateAndSaveWrapper(d.Registry.GetLocalFileURI(baseCachePath), localObjectMetaURI, wrapperCachePath)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to fetch ObjectMeta schema: %w", err)
+		log.Printf("[%s] Failed to generate wrapper for CRD %s: %v", d.Name(), meta.Kind, err)
+		return "", err
 	}
 
-	return localBaseCRDURI, localObjectMetaURI, nil
+	return fileURI, nil
 }
 
 // generateAndSaveWrapper builds the CRD wrapper and saves it to the persistent cache.
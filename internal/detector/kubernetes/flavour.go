@@ -0,0 +1,111 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/glob"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const (
+	// modelineFlavourKey selects the flavour of a single file through a
+	// "# yaml-schema-router: flavour=standalone" modeline.
+	modelineFlavourKey = "flavour"
+
+	// definitionsFileName is the shared definitions file referenced by the
+	// schemas of the non-standalone flavour.
+	definitionsFileName = "_definitions.json"
+)
+
+// flavourSuffixes maps flavour names and the legacy registry suffixes to the
+// suffix of the registry directories.
+var flavourSuffixes = map[string]string{
+	config.FlavourStrict:     "-standalone-strict",
+	config.FlavourStandalone: "-standalone",
+	config.FlavourNonStrict:  "",
+	"-standalone-strict":     "-standalone-strict",
+	"-standalone":            "-standalone",
+	"":                       "",
+}
+
+// flavourSuffix returns the registry directory suffix of a flavour.
+func flavourSuffix(flavour string) (string, bool) {
+	suffix, ok := flavourSuffixes[strings.TrimSpace(flavour)]
+	return suffix, ok
+}
+
+// kubernetesFlavour picks the registry directory suffix for a file. A router
+// modeline wins, followed by the first matching flavour override and the
+// configured flavour. Unknown flavours fall back to strict validation.
+func kubernetesFlavour(cfg *config.Config, uri string, content []byte) string {
+	var candidates []string
+	if value, ok := detector.ParseModeline(content)[modelineFlavourKey]; ok {
+		candidates = append(candidates, value)
+	}
+	if override, ok := flavourOverride(cfg.Kubernetes.FlavourOverrides, uri); ok {
+		candidates = append(candidates, override)
+	}
+	candidates = append(candidates, cfg.Kubernetes.Flavour)
+
+	for _, flavour := range candidates {
+		if suffix, ok := flavourSuffix(flavour); ok {
+			return suffix
+		}
+		log.Printf("[%s] Ignoring unknown flavour '%s' for %s", K8sDetectorName, flavour, uri)
+	}
+
+	return flavourSuffixes[config.FlavourStrict]
+}
+
+// flavourOverride returns the flavour of the first override whose pattern
+// matches uri. Relative patterns match at any depth, like yaml.schemas globs.
+func flavourOverride(overrides []config.FlavourOverride, uri string) (string, bool) {
+	if len(overrides) == 0 {
+		return "", false
+	}
+
+	path, ok := fileuri.ToPath(uri)
+	if !ok {
+		return "", false
+	}
+	path = filepath.ToSlash(path)
+
+	for _, override := range overrides {
+		pattern := override.Pattern
+		if !strings.HasPrefix(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		if glob.Match(pattern, path) {
+			return override.Flavour, true
+		}
+	}
+
+	return "", false
+}
+
+// ensureDefinitions fetches the shared definitions that schemas of the
+// non-standalone flavour reference relative to their own location.
+func ensureDefinitions(
+	ctx context.Context,
+	registry *schemaregistry.Registry,
+	cfg *config.Config,
+	target schemaTarget,
+) error {
+	if target.standalone() {
+		return nil
+	}
+
+	_, err := registry.LookupSibling(ctx, builtinCatalog(cfg), target.objectMetaRef(), definitionsFileName)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", definitionsFileName, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+// staticBuiltinGroups are the API groups served by kube-apiserver itself,
+// used when the upstream definitions of a version cannot be fetched. The
+// core group is the empty string.
+var staticBuiltinGroups = []string{
+	"",
+	"admissionregistration.k8s.io",
+	"apiextensions.k8s.io",
+	"apiregistration.k8s.io",
+	"apps",
+	"authentication.k8s.io",
+	"authorization.k8s.io",
+	"autoscaling",
+	"batch",
+	"certificates.k8s.io",
+	"coordination.k8s.io",
+	"discovery.k8s.io",
+	"events.k8s.io",
+	"extensions",
+	"flowcontrol.apiserver.k8s.io",
+	"internal.apiserver.k8s.io",
+	"networking.k8s.io",
+	"node.k8s.io",
+	"policy",
+	"rbac.authorization.k8s.io",
+	"resource.k8s.io",
+	"scheduling.k8s.io",
+	"storage.k8s.io",
+	"storagemigration.k8s.io",
+}
+
+// GroupIndex classifies API groups as built-in or custom for a Kubernetes
+// version. The built-in groups of each version are read from the
+// x-kubernetes-group-version-kind annotations of the upstream
+// _definitions.json, falling back to a static table while it is unavailable.
+type GroupIndex struct {
+	Registry *schemaregistry.Registry
+	Config   *config.Config
+
+	mu       sync.Mutex
+	versions map[string]map[string]bool
+	fallback map[string]bool
+
+	// retryAt holds when the definitions of versions that failed to load are
+	// retried; until then the fallback is used.
+	retryAt map[string]time.Time
+
+	// loading holds a channel per version being loaded, closed once it is.
+	loading map[string]chan struct{}
+}
+
+// NewGroupIndex creates an index loading definitions through registry.
+func NewGroupIndex(registry *schemaregistry.Registry, cfg *config.Config) *GroupIndex {
+	fallback := make(map[string]bool, len(staticBuiltinGroups))
+	for _, group := range staticBuiltinGroups {
+		fallback[group] = true
+	}
+
+	g := &GroupIndex{
+		Registry: registry,
+		Config:   cfg,
+		versions: make(map[string]map[string]bool),
+		fallback: fallback,
+		retryAt:  make(map[string]time.Time),
+		loading:  make(map[string]chan struct{}),
+	}
+	registry.OnChange(g.forget)
+
+	return g
+}
+
+// forget drops the groups of a version whose definitions were updated, so
+// they are indexed again on next use.
+func (g *GroupIndex) forget(cachePath string) {
+	if filepath.Base(cachePath) != definitionsFileName {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	version := filepath.Base(filepath.Dir(cachePath))
+	delete(g.versions, version)
+	delete(g.retryAt, version)
+}
+
+// IsBuiltin reports whether group is served by kube-apiserver in the given
+// Kubernetes version, e.g. "v1.29.0".
+func (g *GroupIndex) IsBuiltin(ctx context.Context, version, group string) bool {
+	return g.groups(ctx, version)[group]
+}
+
+// groups returns the built-in groups of a version, loading them on first use.
+// The definitions are loaded without holding g.mu, so detections of other
+// versions don't wait for the download; concurrent callers for the same
+// version wait for a single load. Failed loads fall back to the static table
+// until the registry's backoff for the definitions expires.
+func (g *GroupIndex) groups(ctx context.Context, version string) map[string]bool {
+	for {
+		g.mu.Lock()
+		if groups, ok := g.versions[version]; ok {
+			g.mu.Unlock()
+			return groups
+		}
+		if time.Now().Before(g.retryAt[version]) {
+			g.mu.Unlock()
+			return g.fallback
+		}
+
+		loading, ok := g.loading[version]
+		if !ok {
+			break
+		}
+		g.mu.Unlock()
+
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return g.fallback
+		}
+	}
+
+	done := make(chan struct{})
+	g.loading[version] = done
+	g.mu.Unlock()
+
+	groups, err := g.load(ctx, version)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.loading, version)
+	close(done)
+
+	if err != nil {
+		log.Printf("[%s] Using static built-in API groups for %s: %v", K8sDetectorName, version, err)
+		if retryAt, ok := schemaregistry.RetryAt(err); ok {
+			g.retryAt[version] = retryAt
+		}
+		return g.fallback
+	}
+
+	g.versions[version] = groups
+	return groups
+}
+
+// load collects the groups of every kind in the definitions of a version.
+// The non-standalone registry directory is the only one shipping them.
+func (g *GroupIndex) load(ctx context.Context, version string) (map[string]bool, error) {
+	target := schemaTarget{Version: version}
+	localURI, err := g.Registry.LookupSibling(ctx, builtinCatalog(g.Config), target.objectMetaRef(), definitionsFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	path, _ := fileuri.ToPath(localURI)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A cached file that can't be indexed won't get better by retrying.
+	groups, ok := parseBuiltinGroups(data)
+	if !ok {
+		log.Printf("[%s] No API groups found in %s, using static built-in API groups", K8sDetectorName, path)
+		return g.fallback, nil
+	}
+
+	log.Printf("[%s] Indexed %d built-in API groups for %s", K8sDetectorName, len(groups), version)
+	return groups, nil
+}
+
+// definitionsDocument is the part of _definitions.json naming the group,
+// version and kind of every resource.
+type definitionsDocument struct {
+	Definitions map[string]struct {
+		GroupVersionKinds []groupVersionKind `json:"x-kubernetes-group-version-kind"`
+	} `json:"definitions"`
+}
+
+type groupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// parseBuiltinGroups reads the group of every kind annotated in the definitions.
+func parseBuiltinGroups(data []byte) (map[string]bool, bool) {
+	var definitions definitionsDocument
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, false
+	}
+
+	groups := map[string]bool{"": true}
+	for _, definition := range definitions.Definitions {
+		for _, gvk := range definition.GroupVersionKinds {
+			groups[gvk.Group] = true
+		}
+	}
+
+	return groups, len(groups) > 1
+}
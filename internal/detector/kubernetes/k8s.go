@@ -2,12 +2,12 @@
 package kubernetes
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
-	"net/url"
-	"path/filepath"
 	"strings"
 
+	"go.trai.ch/yaml-schema-router/internal/cluster"
 	"go.trai.ch/yaml-schema-router/internal/config"
 	"go.trai.ch/yaml-schema-router/internal/detector"
 	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
@@ -16,6 +16,16 @@ import (
 // K8sDetector implements the detector.Detector interface for Kubernetes manifests.
 type K8sDetector struct {
 	Registry *schemaregistry.Registry
+	Config   *config.Config
+	Groups   *GroupIndex
+
+	// Cluster, if set and enabled, provides schemas from the API server,
+	// which take precedence over the schema registry.
+	Cluster *cluster.Source
+
+	// Fallback, if set, looks up resources of built-in groups whose schema is
+	// missing upstream in the CRD catalog instead.
+	Fallback *CRDDetector
 }
 
 var _ detector.Detector = (*K8sDetector)(nil)
@@ -28,117 +38,86 @@ func (d *K8sDetector) Name() string {
 	return K8sDetectorName
 }
 
-type typeMeta struct {
-	APIVersion string
-	Kind       string
-}
-
 // Detect inspects the YAML content for all Kubernetes apiVersion and kind pairs
-// to construct the appropriate schema URLs.
-func (d *K8sDetector) Detect(_ string, content []byte) ([]string, error) {
+// to construct the appropriate schema URLs. Documents whose schema could not
+// be fetched are returned as detector.UnresolvedErrors next to the matches.
+func (d *K8sDetector) Detect(ctx context.Context, uri string, content []byte) ([]detector.Match, error) {
 	metas := extractAllTypeMeta(content)
 	if len(metas) == 0 {
 		return nil, nil
 	}
 
-	var schemaURLs []string
+	target := resolveSchemaTarget(d.Config, uri, content)
+	var (
+		matches    []detector.Match
+		unresolved []error
+	)
 
 	for _, meta := range metas {
-		if schemaURL := d.resolveSchemaURL(meta); schemaURL != "" {
-			schemaURLs = append(schemaURLs, schemaURL)
+		schemaURL, err := d.resolveSchemaURL(ctx, meta, target)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			unresolved = append(unresolved, meta.unresolved(err))
+			continue
+		}
+		if schemaURL != "" {
+			matches = append(matches, meta.match(schemaURL))
 		}
 	}
 
-	return schemaURLs, nil
+	return matches, errors.Join(unresolved...)
 }
 
-func (d *K8sDetector) resolveSchemaURL(meta typeMeta) string {
+// resolveSchemaURL returns the schema of a built-in resource. It returns no
+// schema and no error for documents that are not built-in resources.
+func (d *K8sDetector) resolveSchemaURL(ctx context.Context, meta typeMeta, target schemaTarget) (string, error) {
 	log.Printf("[%s] Found apiVersion='%s', kind='%s'", d.Name(), meta.APIVersion, meta.Kind)
 
 	if meta.Kind == "CustomResourceDefinition" {
 		log.Printf("[%s] Ignoring CustomResourceDefinition", d.Name())
-		return ""
+		return "", nil
 	}
 
-	group := meta.APIVersion
-	version := ""
-	if strings.Contains(group, "/") {
-		parts := strings.Split(group, "/")
-		group = parts[0]
-		version = parts[1]
-	}
-
-	// If the group contains a dot but doesn't end with k8s.io, it is a custom resource.
-	if strings.Contains(group, ".") && !strings.HasSuffix(group, "k8s.io") {
+	group, version := splitAPIVersion(meta.APIVersion)
+	if !d.Groups.IsBuiltin(ctx, target.Version, group) {
 		log.Printf("[%s] Ignoring Custom Resource (group: %s)", d.Name(), group)
-		return ""
-	}
-
-	// Standardize the API group name for the schema registry by stripping the domain
-	// e.g., "rbac.authorization.k8s.io" -> "rbac", "networking.k8s.io" -> "networking"
-	formattedGroup := group
-	if strings.Contains(formattedGroup, ".") && strings.HasSuffix(formattedGroup, "k8s.io") {
-		formattedGroup = strings.Split(formattedGroup, ".")[0]
+		return "", nil
 	}
 
-	var apiVersionFormatted string
-	if version != "" {
-		apiVersionFormatted = fmt.Sprintf("%s-%s", formattedGroup, version)
-	} else {
-		apiVersionFormatted = formattedGroup // For core groups like "v1"
+	if localURI, ok := clusterSchemaURI(ctx, d.Cluster, meta, group, version, target); ok {
+		return localURI, nil
 	}
 
-	kindFormatted := strings.ToLower(meta.Kind)
-	fileName := fmt.Sprintf("%s-%s.json", kindFormatted, apiVersionFormatted)
-	versionDir := fmt.Sprintf("%s%s", config.DefaultK8sSchemaVersion, config.DefaultK8sSchemaFlavour)
-
-	remoteSchemaURL, err := url.JoinPath(
-		config.DefaultK8sSchemaRegistry,
-		versionDir,
-		fileName,
-	)
+	localURI, err := d.Registry.Lookup(ctx, builtinCatalog(d.Config), target.ref(group, version, meta.Kind))
 	if err != nil {
-		log.Printf("[%s] Failed to build URL for %s: %v", d.Name(), meta.Kind, err)
-		return ""
+		log.Printf("[%s] Failed to fetch schema for %s: %v", d.Name(), meta.Kind, err)
+		if d.Fallback != nil && group != "" && ctx.Err() == nil {
+			log.Printf("[%s] Falling back to CRD lookup for %s/%s", d.Name(), group, meta.Kind)
+			fallbackURI, fallbackErr := d.Fallback.resolveSchemaURL(ctx, meta, group, version, target)
+			if fallbackErr != nil {
+				return "", errors.Join(err, fallbackErr)
+			}
+			return fallbackURI, nil
+		}
+		return "", err
 	}
 
-	cachePath := filepath.Join(d.Name(), versionDir, fileName)
-	localURI, err := d.Registry.GetSchemaURI(remoteSchemaURL, cachePath)
-	if err != nil {
-		log.Printf("[%s] Failed to fetch schema for %s: %v", d.Name(), meta.Kind, err)
-		return ""
+	if err := ensureDefinitions(ctx, d.Registry, d.Config, target); err != nil {
+		log.Printf("[%s] Failed to fetch definitions for %s: %v", d.Name(), meta.Kind, err)
+		return "", err
 	}
 
-	return localURI
+	return localURI, nil
 }
 
-// extractAllTypeMeta splits the raw YAML content by document separators
-// and extracts the apiVersion and kind for each segment.
-func extractAllTypeMeta(content []byte) []typeMeta {
-	var metas []typeMeta
-	docs := strings.SplitSeq(string(content), "---")
-
-	for doc := range docs {
-		var apiVersion, kind string
-		for line := range strings.SplitSeq(doc, "\n") {
-			// Only check top-level keys
-			if after, ok := strings.CutPrefix(line, "apiVersion:"); ok {
-				apiVersion = strings.TrimSpace(after)
-				apiVersion = strings.Trim(apiVersion, `"'`)
-			} else if after0, ok0 := strings.CutPrefix(line, "kind:"); ok0 {
-				kind = strings.TrimSpace(after0)
-				kind = strings.Trim(kind, `"'`)
-			}
-
-			if apiVersion != "" && kind != "" {
-				break
-			}
-		}
-
-		if apiVersion != "" && kind != "" {
-			metas = append(metas, typeMeta{APIVersion: apiVersion, Kind: kind})
-		}
+// splitAPIVersion splits an apiVersion into its group and version. Core
+// resources such as "v1" have no group.
+func splitAPIVersion(apiVersion string) (group, version string) {
+	group, version, found := strings.Cut(apiVersion, "/")
+	if !found {
+		return "", apiVersion
 	}
-
-	return metas
+	return group, version
 }
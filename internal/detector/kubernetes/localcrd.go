@@ -0,0 +1,429 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/yamldoc"
+)
+
+const (
+	// localCRDRescanInterval limits how often the scanned directories are
+	// checked for added, removed or renamed files.
+	localCRDRescanInterval = 2 * time.Second
+
+	// maxLocalCRDFileSize skips files too large to plausibly be manifests.
+	maxLocalCRDFileSize = 16 << 20
+)
+
+// LocalCRDIndex indexes the CustomResourceDefinition manifests found in the
+// workspace and the configured crd.localDirs. The directories are walked once;
+// afterwards only directories whose modification time changed are listed
+// again, in the background, and files the editor opens or saves are re-read
+// through FileChanged. Lookups never wait for a walk other than the first,
+// which their context cancels.
+type LocalCRDIndex struct {
+	Config *config.Config
+
+	// scanMu serializes scans and guards the scan state below.
+	scanMu     sync.Mutex
+	files      map[string]*localCRDFile
+	dirs       map[string]time.Time
+	duplicates map[string]bool
+
+	// mu guards the published index.
+	mu        sync.Mutex
+	scanned   string
+	lastCheck time.Time
+	checking  bool
+	versions  map[string]*localCRD
+}
+
+// localCRD is one served version of a CustomResourceDefinition.
+type localCRD struct {
+	Path string
+
+	// Schema is the version's openAPIV3Schema as found in the manifest.
+	Schema map[string]any
+}
+
+type localCRDFile struct {
+	modTime time.Time
+	size    int64
+	crds    map[string]*localCRD
+}
+
+// crdManifest holds the fields of apiextensions.k8s.io/v1 and v1beta1
+// CustomResourceDefinitions needed to find their schemas.
+type crdManifest struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		Group string `yaml:"group"`
+		Names struct {
+			Kind string `yaml:"kind"`
+		} `yaml:"names"`
+		// Version and Validation are the v1beta1 schema shared by all versions.
+		Version    string         `yaml:"version"`
+		Validation *crdValidation `yaml:"validation"`
+		Versions   []struct {
+			Name   string         `yaml:"name"`
+			Schema *crdValidation `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+type crdValidation struct {
+	OpenAPIV3Schema map[string]any `yaml:"openAPIV3Schema"`
+}
+
+// NewLocalCRDIndex creates an index scanning the directories configured in cfg.
+func NewLocalCRDIndex(cfg *config.Config) *LocalCRDIndex {
+	return &LocalCRDIndex{
+		Config:     cfg,
+		files:      make(map[string]*localCRDFile),
+		dirs:       make(map[string]time.Time),
+		duplicates: make(map[string]bool),
+		versions:   make(map[string]*localCRD),
+	}
+}
+
+// lookup returns the local CRD defining kind in the given group and version.
+func (x *LocalCRDIndex) lookup(ctx context.Context, group, version, kind string) (*localCRD, bool) {
+	roots := x.roots()
+	key := strings.Join(roots, "\x00")
+
+	x.mu.Lock()
+	if x.scanned != key {
+		x.mu.Unlock()
+		x.scan(ctx, roots, key)
+		x.mu.Lock()
+	} else if time.Since(x.lastCheck) >= localCRDRescanInterval && !x.checking {
+		x.checking = true
+		go x.checkDirs()
+	}
+
+	crd, ok := x.versions[crdKey(group, version, kind)]
+	x.mu.Unlock()
+	return crd, ok
+}
+
+// FileChanged re-reads a file the editor opened or saved if it is in one of
+// the scanned directories.
+func (x *LocalCRDIndex) FileChanged(uri string) {
+	path, ok := fileuri.ToPath(uri)
+	if !ok || !isManifestFile(path) {
+		return
+	}
+
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+
+	if _, scanned := x.dirs[filepath.Dir(path)]; !scanned {
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(x.files, path)
+	} else if !x.refreshFile(path, info) {
+		return
+	}
+	x.publish()
+}
+
+func crdKey(group, version, kind string) string {
+	return group + "/" + version + "/" + strings.ToLower(kind)
+}
+
+// roots returns the directories to scan: the workspace root followed by the
+// configured local directories.
+func (x *LocalCRDIndex) roots() []string {
+	root := x.Config.WorkspaceRoot
+	roots := make([]string, 0, len(x.Config.CRD.LocalDirs)+1)
+	if root != "" {
+		roots = append(roots, root)
+	}
+
+	for _, dir := range x.Config.CRD.LocalDirs {
+		if !filepath.IsAbs(dir) {
+			if root == "" {
+				continue
+			}
+			dir = filepath.Join(root, dir)
+		}
+		roots = append(roots, dir)
+	}
+
+	return roots
+}
+
+// scan walks the roots from scratch and publishes the resulting index under
+// key, unless a concurrent lookup already did. A scan canceled through ctx
+// publishes nothing, so the next lookup starts over.
+func (x *LocalCRDIndex) scan(ctx context.Context, roots []string, key string) {
+	x.scanMu.Lock()
+	defer x.scanMu.Unlock()
+
+	x.mu.Lock()
+	done := x.scanned == key
+	x.mu.Unlock()
+	if done {
+		return
+	}
+
+	x.files = make(map[string]*localCRDFile)
+	x.dirs = make(map[string]time.Time)
+	for _, root := range roots {
+		if err := x.walk(ctx, root); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("[%s] Failed to scan %s for CRDs: %v", CRDDetectorName, root, err)
+		}
+	}
+
+	x.publish()
+	x.mu.Lock()
+	x.scanned = key
+	x.lastCheck = time.Now()
+	x.mu.Unlock()
+}
+
+// walk indexes every manifest and records the modification time of every
+// directory below root. It stops with the context's error once ctx is
+// canceled.
+func (x *LocalCRDIndex) walk(ctx context.Context, root string) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			return nil //nolint:nilerr // unreadable entries are skipped
+		case entry.IsDir() && path != root && skipDir(entry.Name()):
+			return filepath.SkipDir
+		case !entry.IsDir() && !isManifestFile(entry.Name()):
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil //nolint:nilerr // entries removed meanwhile are skipped
+		}
+		if entry.IsDir() {
+			x.dirs[path] = info.ModTime()
+		} else if _, seen := x.files[path]; !seen {
+			x.refreshFile(path, info)
+		}
+		return nil
+	})
+}
+
+// checkDirs lists the directories whose modification time changed since
+// they were scanned, which happens when files are added, removed or renamed.
+func (x *LocalCRDIndex) checkDirs() {
+	x.scanMu.Lock()
+	changed := false
+	for dir, modTime := range x.dirs {
+		info, err := os.Stat(dir)
+		switch {
+		case err != nil:
+			x.forget(dir)
+		case !info.ModTime().Equal(modTime):
+			x.dirs[dir] = info.ModTime()
+			x.rescanDir(dir)
+		default:
+			continue
+		}
+		changed = true
+	}
+	if changed {
+		x.publish()
+	}
+	x.scanMu.Unlock()
+
+	x.mu.Lock()
+	x.lastCheck = time.Now()
+	x.checking = false
+	x.mu.Unlock()
+}
+
+// rescanDir lists dir again: new and changed manifests are read, new
+// directories walked and removed entries dropped.
+func (x *LocalCRDIndex) rescanDir(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		x.forget(dir)
+		return
+	}
+
+	present := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		present[path] = true
+
+		switch {
+		case entry.IsDir():
+			if _, known := x.dirs[path]; !known && !skipDir(entry.Name()) {
+				_ = x.walk(context.Background(), path)
+			}
+		case isManifestFile(entry.Name()):
+			if info, err := entry.Info(); err == nil {
+				x.refreshFile(path, info)
+			}
+		}
+	}
+
+	for path := range x.files {
+		if filepath.Dir(path) == dir && !present[path] {
+			delete(x.files, path)
+		}
+	}
+	for path := range x.dirs {
+		if filepath.Dir(path) == dir && !present[path] {
+			x.forget(path)
+		}
+	}
+}
+
+// forget drops dir and everything below it from the scan state.
+func (x *LocalCRDIndex) forget(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for path := range x.dirs {
+		if path == dir || strings.HasPrefix(path, prefix) {
+			delete(x.dirs, path)
+		}
+	}
+	for path := range x.files {
+		if strings.HasPrefix(path, prefix) {
+			delete(x.files, path)
+		}
+	}
+}
+
+// publish indexes the versions defined by the scanned files. When several
+// files define the same version, the first one in path order wins.
+func (x *LocalCRDIndex) publish() {
+	paths := make([]string, 0, len(x.files))
+	for path := range x.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	versions := make(map[string]*localCRD)
+	for _, path := range paths {
+		for key, crd := range x.files[path].crds {
+			existing, ok := versions[key]
+			if !ok {
+				versions[key] = crd
+				continue
+			}
+			if duplicate := key + "\x00" + path; !x.duplicates[duplicate] {
+				x.duplicates[duplicate] = true
+				log.Printf("[%s] Ignoring %s from %s, already defined in %s", CRDDetectorName, key, path, existing.Path)
+			}
+		}
+	}
+
+	x.mu.Lock()
+	x.versions = versions
+	x.mu.Unlock()
+}
+
+// refreshFile re-reads path unless it is unchanged since it was last read,
+// and reports whether it was read.
+func (x *LocalCRDIndex) refreshFile(path string, info fs.FileInfo) bool {
+	if info.Size() > maxLocalCRDFileSize {
+		return false
+	}
+
+	if cached, ok := x.files[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return false
+	}
+
+	file := &localCRDFile{modTime: info.ModTime(), size: info.Size()}
+	x.files[path] = file
+
+	data, err := os.ReadFile(path)
+	if err != nil || !bytes.Contains(data, []byte("CustomResourceDefinition")) {
+		return true
+	}
+
+	file.crds = parseCRDs(path, data)
+	if len(file.crds) > 0 {
+		log.Printf("[%s] Indexed %d local CRD version(s) from %s", CRDDetectorName, len(file.crds), path)
+	}
+	return true
+}
+
+// parseCRDs extracts every version schema defined in a manifest file.
+func parseCRDs(path string, data []byte) map[string]*localCRD {
+	crds := make(map[string]*localCRD)
+
+	for _, doc := range yamldoc.Split(data) {
+		if doc.Node == nil {
+			continue
+		}
+
+		var manifest crdManifest
+		if err := doc.Node.Decode(&manifest); err != nil || manifest.Kind != "CustomResourceDefinition" {
+			continue
+		}
+
+		spec := manifest.Spec
+		if spec.Group == "" || spec.Names.Kind == "" {
+			continue
+		}
+
+		for version, schema := range manifest.versionSchemas() {
+			crds[crdKey(spec.Group, version, spec.Names.Kind)] = &localCRD{Path: path, Schema: schema}
+		}
+	}
+
+	return crds
+}
+
+// versionSchemas returns the openAPIV3Schema of every version. Versions
+// without their own schema use the v1beta1 top-level validation.
+func (m *crdManifest) versionSchemas() map[string]map[string]any {
+	schemas := make(map[string]map[string]any)
+	add := func(version string, validation *crdValidation) {
+		if version != "" && validation != nil && validation.OpenAPIV3Schema != nil {
+			schemas[version] = validation.OpenAPIV3Schema
+		}
+	}
+
+	add(m.Spec.Version, m.Spec.Validation)
+	for _, version := range m.Spec.Versions {
+		if version.Schema != nil {
+			add(version.Name, version.Schema)
+		} else {
+			add(version.Name, m.Spec.Validation)
+		}
+	}
+
+	return schemas
+}
+
+// skipDir reports whether a directory is never worth scanning for manifests.
+func skipDir(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor"
+}
+
+func isManifestFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,26 @@
+package kubernetes
+
+import "go.trai.ch/yaml-schema-router/internal/openapi"
+
+// openAPIToJSONSchema converts the openAPIV3Schema of a CRD version into a
+// JSON Schema. The TypeMeta and ObjectMeta fields are declared at the root,
+// so strict schemas accept them even if the CRD leaves them out.
+func openAPIToJSONSchema(schema map[string]any, strict bool) map[string]any {
+	converted := openapi.ToJSONSchema(schema, strict)
+
+	properties, _ := converted["properties"].(map[string]any)
+	if properties == nil {
+		properties = make(map[string]any)
+		converted["properties"] = properties
+	}
+	for _, field := range []string{"apiVersion", "kind"} {
+		if _, ok := properties[field]; !ok {
+			properties[field] = map[string]any{"type": "string"}
+		}
+	}
+	if _, ok := properties["metadata"]; !ok {
+		properties["metadata"] = map[string]any{"type": "object"}
+	}
+
+	return converted
+}
@@ -0,0 +1,188 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+// prefetchConcurrency is the number of schemas downloaded in parallel.
+const prefetchConcurrency = 8
+
+// PrefetchBuiltin downloads the schemas of every kind served by a Kubernetes
+// version into the cache, in the given flavour, together with ObjectMeta and
+// the version's shared definitions. Kinds whose schema is missing upstream
+// are skipped. It returns the file URIs of the cached schemas.
+func PrefetchBuiltin(
+	ctx context.Context,
+	registry *schemaregistry.Registry,
+	cfg *config.Config,
+	version, flavour string,
+) ([]string, error) {
+	target, err := prefetchTarget(version, flavour)
+	if err != nil {
+		return nil, err
+	}
+	catalog := builtinCatalog(cfg)
+
+	// The non-standalone directory is the only one shipping the definitions
+	base := schemaTarget{Version: target.Version}
+	definitionsURI, err := registry.LookupSibling(ctx, catalog, base.objectMetaRef(), definitionsFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", definitionsFileName, err)
+	}
+	path, _ := fileuri.ToPath(definitionsURI)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions definitionsDocument
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", definitionsFileName, err)
+	}
+
+	refs := []schemaregistry.SchemaRef{target.objectMetaRef()}
+	seen := make(map[groupVersionKind]bool)
+	for _, definition := range definitions.Definitions {
+		for _, gvk := range definition.GroupVersionKinds {
+			if !seen[gvk] {
+				seen[gvk] = true
+				refs = append(refs, target.ref(gvk.Group, gvk.Version, gvk.Kind))
+			}
+		}
+	}
+
+	uris := lookupAll(ctx, registry, catalog, refs)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	// The definitions classify built-in groups, and non-standalone schemas
+	// reference them
+	uris = append(uris, definitionsURI)
+	sort.Strings(uris)
+
+	return uris, nil
+}
+
+// coreKinds are the built-in kinds most manifests consist of.
+var coreKinds = []groupVersionKind{
+	{Group: "", Version: "v1", Kind: "ConfigMap"},
+	{Group: "", Version: "v1", Kind: "Namespace"},
+	{Group: "", Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Group: "", Version: "v1", Kind: "Pod"},
+	{Group: "", Version: "v1", Kind: "Secret"},
+	{Group: "", Version: "v1", Kind: "Service"},
+	{Group: "", Version: "v1", Kind: "ServiceAccount"},
+	{Group: "apps", Version: "v1", Kind: "DaemonSet"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+	{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"},
+	{Group: "batch", Version: "v1", Kind: "CronJob"},
+	{Group: "batch", Version: "v1", Kind: "Job"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "NetworkPolicy"},
+	{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRoleBinding"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "Role"},
+	{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "RoleBinding"},
+}
+
+// PrefetchCore downloads the schemas of the core kinds of a Kubernetes
+// version into the cache, in the given flavour, together with ObjectMeta.
+// Unlike PrefetchBuiltin it fails if any of them can't be fetched. It returns
+// the file URIs of the cached schemas.
+func PrefetchCore(
+	ctx context.Context,
+	registry *schemaregistry.Registry,
+	cfg *config.Config,
+	version, flavour string,
+) ([]string, error) {
+	target, err := prefetchTarget(version, flavour)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []schemaregistry.SchemaRef{target.objectMetaRef()}
+	for _, gvk := range coreKinds {
+		refs = append(refs, target.ref(gvk.Group, gvk.Version, gvk.Kind))
+	}
+
+	uris := lookupAll(ctx, registry, builtinCatalog(cfg), refs)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if len(uris) != len(refs) {
+		return nil, fmt.Errorf("fetched only %d of the %d core schemas of Kubernetes %s",
+			len(uris), len(refs), target.Version)
+	}
+	sort.Strings(uris)
+
+	return uris, nil
+}
+
+// prefetchTarget returns the schemas of version in flavour.
+func prefetchTarget(version, flavour string) (schemaTarget, error) {
+	normalized, ok := normalizeVersion(version)
+	if !ok {
+		return schemaTarget{}, fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	suffix, ok := flavourSuffix(flavour)
+	if !ok {
+		return schemaTarget{}, fmt.Errorf("unknown flavour %q", flavour)
+	}
+
+	return schemaTarget{Version: normalized, Flavour: suffix}, nil
+}
+
+// lookupAll fetches refs in parallel and returns the file URIs of those that
+// could be fetched.
+func lookupAll(
+	ctx context.Context,
+	registry *schemaregistry.Registry,
+	catalog schemaregistry.Catalog,
+	refs []schemaregistry.SchemaRef,
+) []string {
+	var (
+		mu   sync.Mutex
+		uris []string
+		wg   sync.WaitGroup
+	)
+	queue := make(chan schemaregistry.SchemaRef)
+
+	for range prefetchConcurrency {
+		wg.Go(func() {
+			for ref := range queue {
+				uri, err := registry.Lookup(ctx, catalog, ref)
+				if err != nil {
+					log.Printf("[%s] Skipping %s: %v", K8sDetectorName, ref.Kind, err)
+					continue
+				}
+
+				mu.Lock()
+				uris = append(uris, uri)
+				mu.Unlock()
+			}
+		})
+	}
+
+	for _, ref := range refs {
+		if ctx.Err() != nil {
+			break
+		}
+		queue <- ref
+	}
+	close(queue)
+	wg.Wait()
+
+	return uris
+}
@@ -0,0 +1,51 @@
+package kubernetes
+
+import (
+	"context"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+// CatalogProbe is the outcome of fetching a well-known schema from every
+// source of a catalog.
+type CatalogProbe struct {
+	// Catalog is the name of the catalog, e.g. "kubernetes-builtin".
+	Catalog string
+
+	// Schema describes the probed schema, e.g. "apps/v1 Deployment".
+	Schema string
+
+	Sources []schemaregistry.SourceProbe
+}
+
+// ProbeSources fetches the Deployment schema of the configured Kubernetes
+// version and flavour from the built-in sources, and the cert-manager
+// Certificate schema from the CRD sources, bypassing the cache.
+func ProbeSources(ctx context.Context, cfg *config.Config) []CatalogProbe {
+	version, ok := normalizeVersion(cfg.Kubernetes.Version)
+	if !ok {
+		version, _ = normalizeVersion(config.DefaultK8sSchemaVersion)
+	}
+	flavour, ok := flavourSuffix(cfg.Kubernetes.Flavour)
+	if !ok {
+		flavour, _ = flavourSuffix(config.DefaultK8sSchemaFlavour)
+	}
+	target := schemaTarget{Version: version, Flavour: flavour}
+
+	builtinRef := target.ref("apps", "v1", "Deployment")
+	crdRef := schemaregistry.SchemaRef{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+	return []CatalogProbe{
+		{
+			Catalog: K8sDetectorName,
+			Schema:  "apps/v1 Deployment (" + target.dir() + ")",
+			Sources: schemaregistry.ProbeCatalog(ctx, &cfg.Registry, builtinCatalog(cfg), builtinRef),
+		},
+		{
+			Catalog: CRDDetectorName,
+			Schema:  "cert-manager.io/v1 Certificate",
+			Sources: schemaregistry.ProbeCatalog(ctx, &cfg.Registry, crdCatalog(cfg), crdRef),
+		},
+	}
+}
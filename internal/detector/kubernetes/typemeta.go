@@ -0,0 +1,171 @@
+package kubernetes
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+	"go.trai.ch/yaml-schema-router/internal/yamldoc"
+)
+
+// mergeKey is the YAML merge key, e.g. "<<: *defaults".
+const mergeKey = "<<"
+
+type typeMeta struct {
+	APIVersion string
+	Kind       string
+
+	// StartLine and EndLine are the 1-based, inclusive lines of the document
+	// the TypeMeta was found in.
+	StartLine int
+	EndLine   int
+}
+
+// match builds a detector match whose discriminator restricts schemaURI to
+// documents with this apiVersion and kind.
+func (m typeMeta) match(schemaURI string) detector.Match {
+	return detector.Match{
+		SchemaURI: schemaURI,
+		Discriminator: map[string]string{
+			"apiVersion": m.APIVersion,
+			"kind":       m.Kind,
+		},
+		StartLine: m.StartLine,
+		EndLine:   m.EndLine,
+	}
+}
+
+// unresolved returns the error reporting that the schema of the document
+// could not be fetched, or nil if err says that it does not exist.
+func (m typeMeta) unresolved(err error) error {
+	if schemaregistry.IsNotFound(err) {
+		return nil
+	}
+	return &detector.UnresolvedError{
+		Subject:   m.APIVersion + " " + m.Kind,
+		StartLine: m.StartLine,
+		EndLine:   m.EndLine,
+		Err:       err,
+	}
+}
+
+// extractAllTypeMeta parses the YAML document stream and extracts the
+// apiVersion and kind of every document that declares both. Documents with
+// syntax errors, which are common while typing, fall back to a line scan.
+func extractAllTypeMeta(content []byte) []typeMeta {
+	var metas []typeMeta
+
+	for _, doc := range yamldoc.Split(content) {
+		apiVersion, kind := TypeMeta(doc)
+		if apiVersion != "" && kind != "" {
+			metas = append(metas, typeMeta{
+				APIVersion: apiVersion,
+				Kind:       kind,
+				StartLine:  doc.StartLine,
+				EndLine:    doc.EndLine,
+			})
+		}
+	}
+
+	return metas
+}
+
+// TypeMeta returns the top-level apiVersion and kind of a document, or "" for
+// missing ones. Documents with syntax errors fall back to a line scan.
+func TypeMeta(doc yamldoc.Document) (apiVersion, kind string) {
+	if doc.Node != nil {
+		return typeMetaFromNode(doc.Node)
+	}
+	return typeMetaFromLines(doc.Content)
+}
+
+// typeMetaFromNode reads the top-level apiVersion and kind scalars of a
+// parsed document, following aliases and merge keys.
+func typeMetaFromNode(doc *yaml.Node) (apiVersion, kind string) {
+	root := doc
+	if root.Kind == yaml.DocumentNode && len(root.Content) > 0 {
+		root = root.Content[0]
+	}
+
+	return scalarValue(root, "apiVersion"), scalarValue(root, "kind")
+}
+
+// scalarValue returns the string value of key in a mapping node, or "".
+// Explicit keys take precedence over keys merged in with "<<".
+func scalarValue(mapping *yaml.Node, key string) string {
+	mapping = resolveAlias(mapping)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return ""
+	}
+
+	merged := ""
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		k, v := mapping.Content[i], resolveAlias(mapping.Content[i+1])
+		switch {
+		case k.Value == key && v.Kind == yaml.ScalarNode:
+			return v.Value
+		case k.Value == mergeKey && merged == "":
+			merged = scalarValue(v, key)
+		}
+	}
+
+	return merged
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// typeMetaFromLines is the tolerant fallback for documents that do not parse.
+// It only considers unindented keys and strips quotes and trailing comments.
+func typeMetaFromLines(content []byte) (apiVersion, kind string) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := topLevelValue(line, "apiVersion"); ok {
+			apiVersion = value
+		} else if value, ok := topLevelValue(line, "kind"); ok {
+			kind = value
+		}
+
+		if apiVersion != "" && kind != "" {
+			break
+		}
+	}
+
+	return apiVersion, kind
+}
+
+// topLevelValue returns the value of an unindented "key: value" line, with
+// optional quotes around the key and value and any trailing comment removed.
+func topLevelValue(line, key string) (string, bool) {
+	var rest string
+	found := false
+	for _, quoted := range []string{key, `"` + key + `"`, `'` + key + `'`} {
+		if after, ok := strings.CutPrefix(line, quoted); ok {
+			rest, found = after, true
+			break
+		}
+	}
+	if !found {
+		return "", false
+	}
+
+	rest, ok := strings.CutPrefix(strings.TrimLeft(rest, " \t"), ":")
+	if !ok {
+		return "", false
+	}
+
+	if before, _, hasComment := strings.Cut(rest, " #"); hasComment {
+		rest = before
+	}
+
+	return strings.Trim(strings.TrimSpace(rest), `"'`), true
+}
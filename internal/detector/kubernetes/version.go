@@ -0,0 +1,143 @@
+package kubernetes
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+)
+
+const (
+	// VersionFileName is the project marker holding the Kubernetes version of
+	// the manifests in its directory and below, e.g. "1.29".
+	VersionFileName = ".kubernetes-version"
+
+	// helmChartFileName is the Helm chart manifest whose kubeVersion
+	// constraint selects the version for the chart's templates.
+	helmChartFileName = "Chart.yaml"
+
+	// modelineVersionKey selects the version of a single file through a
+	// "# yaml-schema-router: kubernetes-version=1.29" modeline.
+	modelineVersionKey = "kubernetes-version"
+
+	// masterVersion is the schema directory tracking the latest Kubernetes sources.
+	masterVersion = "master"
+)
+
+var (
+	versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)(?:\.(\d+))?$`)
+
+	// constraintVersionPattern finds the first version of a semver constraint
+	// such as ">= 1.28.0-0 < 1.32.0", which is its lower bound.
+	constraintVersionPattern = regexp.MustCompile(`\d+\.\d+(?:\.\d+)?`)
+)
+
+// normalizeVersion turns "1.29", "v1.29" or "1.29.3" into the "v1.29.0" style
+// directory names of the schema registry. It returns false for anything else.
+func normalizeVersion(version string) (string, bool) {
+	version = strings.TrimSpace(version)
+	if version == masterVersion {
+		return version, true
+	}
+
+	m := versionPattern.FindStringSubmatch(version)
+	if m == nil {
+		return "", false
+	}
+
+	patch := m[3]
+	if patch == "" {
+		patch = "0"
+	}
+
+	return "v" + m[1] + "." + m[2] + "." + patch, true
+}
+
+// kubernetesVersion picks the Kubernetes version for a file. A router
+// modeline wins, followed by the nearest version marker or Helm chart
+// kubeVersion in the file's directory or its parents, and finally the
+// configured version.
+func kubernetesVersion(cfg *config.Config, uri string, content []byte) string {
+	if value, ok := detector.ParseModeline(content)[modelineVersionKey]; ok {
+		if version, ok := normalizeVersion(value); ok {
+			return version
+		}
+		log.Printf("[%s] Ignoring invalid modeline version '%s' in %s", K8sDetectorName, value, uri)
+	}
+
+	if path, ok := fileuri.ToPath(uri); ok {
+		if version, ok := projectVersion(filepath.Dir(path), cfg.WorkspaceRoot); ok {
+			return version
+		}
+	}
+
+	if version, ok := normalizeVersion(cfg.Kubernetes.Version); ok {
+		return version
+	}
+
+	return cfg.Kubernetes.Version
+}
+
+// projectVersion walks up from dir, stopping at the workspace root when dir
+// is inside it, and returns the version declared by the first marker file or
+// Helm chart found.
+func projectVersion(dir, workspaceRoot string) (string, bool) {
+	stop := ""
+	if workspaceRoot != "" {
+		if rel, err := filepath.Rel(workspaceRoot, dir); err == nil && !strings.HasPrefix(rel, "..") {
+			stop = filepath.Clean(workspaceRoot)
+		}
+	}
+
+	for {
+		if version, ok := markerVersion(filepath.Join(dir, VersionFileName)); ok {
+			return version, true
+		}
+		if version, ok := chartVersion(filepath.Join(dir, helmChartFileName)); ok {
+			return version, true
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == stop || parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func markerVersion(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	version, ok := normalizeVersion(string(bytes.TrimSpace(data)))
+	if !ok {
+		log.Printf("[%s] Ignoring invalid version in %s", K8sDetectorName, path)
+	}
+	return version, ok
+}
+
+func chartVersion(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	var chart struct {
+		KubeVersion string `yaml:"kubeVersion"`
+	}
+	if err := yaml.Unmarshal(data, &chart); err != nil || chart.KubeVersion == "" {
+		return "", false
+	}
+
+	return normalizeVersion(constraintVersionPattern.FindString(chart.KubeVersion))
+}
@@ -0,0 +1,58 @@
+package detector
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+const (
+	// ModelinePrefix starts a router modeline, e.g.
+	// "# yaml-schema-router: kubernetes-version=v1.29.0".
+	ModelinePrefix = "# yaml-schema-router:"
+
+	// SchemaAnnotationPrefix starts a manual schema annotation of the
+	// yaml-language-server, which takes precedence over the router.
+	SchemaAnnotationPrefix = "# yaml-language-server: $schema="
+
+	// maxSchemaScanLines is how many leading lines are searched for a manual
+	// schema annotation.
+	maxSchemaScanLines = 10
+)
+
+// ParseModeline collects the key=value settings of every router modeline in
+// content. Modelines must be unindented comments; later ones override
+// earlier settings.
+func ParseModeline(content []byte) map[string]string {
+	settings := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		rest, ok := strings.CutPrefix(scanner.Text(), ModelinePrefix)
+		if !ok {
+			continue
+		}
+
+		for _, field := range strings.Fields(rest) {
+			if key, value, found := strings.Cut(field, "="); found && key != "" {
+				settings[key] = value
+			}
+		}
+	}
+
+	return settings
+}
+
+// SchemaAnnotation returns the schema of a manual schema annotation (e.g.
+// `# yaml-language-server: $schema=...`) in the first few lines of content.
+// Files with one are left to the language server.
+func SchemaAnnotation(content []byte) (string, bool) {
+	lines := strings.SplitN(string(content), "\n", maxSchemaScanLines)
+	for _, line := range lines {
+		// Check if the line is exactly the modeline format
+		if schema, ok := strings.CutPrefix(strings.TrimSpace(line), SchemaAnnotationPrefix); ok {
+			return strings.TrimSpace(schema), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,44 @@
+// Package fileuri converts between LSP document URIs and local file paths.
+package fileuri
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+const scheme = "file"
+
+// ToPath converts a file:// URI into a local path. The second return value is
+// false for URIs with any other scheme.
+func ToPath(uri string) (string, bool) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != scheme {
+		return "", false
+	}
+
+	path := parsed.Path
+	// Windows drive letters arrive as /C:/...
+	if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+
+	return filepath.FromSlash(path), true
+}
+
+// FromPath converts a local path into a file:// URI. Relative paths are made
+// absolute first.
+func FromPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	slashed := filepath.ToSlash(abs)
+	// Windows drive letters become /C:/...
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+
+	return (&url.URL{Scheme: scheme, Path: slashed}).String(), nil
+}
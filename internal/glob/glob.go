@@ -0,0 +1,74 @@
+// Package glob matches slash-separated paths against glob patterns in the
+// style used by the yaml-language-server's schema associations.
+package glob
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Match reports whether name matches pattern. Supported syntax:
+//
+//   - "**" matches any number of path segments, including none
+//   - "*" matches any run of characters except "/"
+//   - "?" matches a single character except "/"
+//   - "{a,b}" matches either alternative
+//
+// Invalid patterns never match.
+func Match(pattern, name string) bool {
+	re, err := regexp.Compile(toRegexp(pattern))
+	if err != nil {
+		return false
+	}
+	return re.MatchString(name)
+}
+
+// toRegexp translates a glob pattern into an anchored regular expression.
+func toRegexp(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+
+	inGroup := false
+	for i := 0; i < len(pattern); i++ {
+		if expr, n := wildcard(pattern[i:]); n > 0 {
+			b.WriteString(expr)
+			i += n - 1
+			continue
+		}
+		b.WriteString(literal(pattern[i], &inGroup))
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
+
+// wildcard translates the wildcard at the start of rest and returns the
+// number of pattern bytes it consumed, or 0 if rest does not start with one.
+func wildcard(rest string) (string, int) {
+	switch {
+	case strings.HasPrefix(rest, "**/"):
+		return "(?:.*/)?", len("**/")
+	case strings.HasPrefix(rest, "**"):
+		return ".*", len("**")
+	case rest[0] == '*':
+		return "[^/]*", 1
+	case rest[0] == '?':
+		return "[^/]", 1
+	}
+	return "", 0
+}
+
+// literal translates a non-wildcard character, tracking "{a,b}" groups.
+func literal(c byte, inGroup *bool) string {
+	switch {
+	case c == '{':
+		*inGroup = true
+		return "(?:"
+	case c == '}' && *inGroup:
+		*inGroup = false
+		return ")"
+	case c == ',' && *inGroup:
+		return "|"
+	}
+	return regexp.QuoteMeta(string(c))
+}
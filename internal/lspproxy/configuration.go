@@ -0,0 +1,123 @@
+package lspproxy
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	componentConfiguration = "Configuration"
+
+	// configurationUpdateDelay is how long state changes are collected before
+	// the language server is told to refresh its configuration.
+	configurationUpdateDelay = 50 * time.Millisecond
+)
+
+// scheduleConfigurationUpdate coalesces bursts of state changes, such as an
+// editor closing many documents at once, into a single configuration update.
+func (p *Proxy) scheduleConfigurationUpdate() {
+	p.updateMutex.Lock()
+	defer p.updateMutex.Unlock()
+
+	if p.updatePending {
+		return
+	}
+	p.updatePending = true
+
+	time.AfterFunc(configurationUpdateDelay, func() {
+		p.updateMutex.Lock()
+		p.updatePending = false
+		p.updateMutex.Unlock()
+
+		p.triggerConfigurationUpdate()
+	})
+}
+
+// triggerConfigurationUpdate makes the language server pick up the current
+// schema mappings, either by letting it pull its configuration or, for editors
+// without workspace/configuration support, by pushing the settings directly.
+func (p *Proxy) triggerConfigurationUpdate() {
+	if !p.pullConfiguration {
+		p.pushConfiguration()
+		return
+	}
+
+	log.Printf("[%s] Triggering configuration pull (sending workspace/didChangeConfiguration)", componentName)
+	// A barebones payload is enough to trigger the pullConfiguration() flow
+	payload := []byte(`{"jsonrpc":"2.0","method":"workspace/didChangeConfiguration"}`)
+	p.forwardToServer(payload)
+}
+
+// pushConfiguration sends a full workspace/didChangeConfiguration built from
+// the last settings the editor pushed, with the router's schemas injected.
+func (p *Proxy) pushConfiguration() {
+	p.settingsMutex.Lock()
+	settings := p.editorSettings
+	p.settingsMutex.Unlock()
+
+	payload, err := p.buildConfigurationPush(settings)
+	if err != nil {
+		log.Printf("[%s] Error building configuration push: %v", componentConfiguration, err)
+		return
+	}
+
+	log.Printf("[%s] Pushing settings (sending workspace/didChangeConfiguration)", componentConfiguration)
+	p.forwardToServer(payload)
+}
+
+// handleDidChangeConfiguration remembers the settings pushed by the editor.
+// For editors that don't answer configuration pulls, the router's schemas are
+// injected into the notification before it reaches the server.
+func (p *Proxy) handleDidChangeConfiguration(payload []byte) []byte {
+	var notif DidChangeConfigurationNotification
+	if err := json.Unmarshal(payload, &notif); err != nil {
+		log.Printf("Error unmarshaling didChangeConfiguration: %v", err)
+		return payload
+	}
+
+	p.settingsMutex.Lock()
+	p.editorSettings = notif.Params.Settings
+	p.settingsMutex.Unlock()
+
+	if p.pullConfiguration {
+		return payload
+	}
+
+	modifiedPayload, err := p.buildConfigurationPush(notif.Params.Settings)
+	if err != nil {
+		log.Printf("[%s] Error injecting schemas into pushed settings: %v", componentConfiguration, err)
+		return payload
+	}
+
+	return modifiedPayload
+}
+
+// buildConfigurationPush returns a workspace/didChangeConfiguration payload
+// whose yaml section has the feature defaults and router schemas injected.
+func (p *Proxy) buildConfigurationPush(rawSettings json.RawMessage) ([]byte, error) {
+	settings := make(map[string]any)
+	if len(rawSettings) > 0 && string(rawSettings) != "null" {
+		if err := json.Unmarshal(rawSettings, &settings); err != nil {
+			return nil, err
+		}
+	}
+
+	yamlConfig, ok := settings[yamlSection].(map[string]any)
+	if !ok {
+		yamlConfig = make(map[string]any)
+	}
+	p.injectYAMLConfig(yamlConfig, "")
+	settings[yamlSection] = yamlConfig
+
+	newSettings, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(DidChangeConfigurationNotification{
+		JSONRPC: "2.0",
+		Method:  "workspace/didChangeConfiguration",
+		Params:  DidChangeConfigurationParams{Settings: newSettings},
+	})
+}
@@ -0,0 +1,100 @@
+package lspproxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// detectionScheduler runs document detection off the editor message loop.
+// Every URI has at most one pending run: scheduling a newer revision cancels
+// the previous one, and runs for the same URI never overlap.
+type detectionScheduler struct {
+	ctx context.Context
+	run func(ctx context.Context, uri, text string)
+
+	mu      sync.Mutex
+	workers map[string]*detectionWorker
+}
+
+// detectionWorker tracks the latest scheduled run for a single URI.
+type detectionWorker struct {
+	// running serializes runs so a stale one finishes before its successor starts.
+	running sync.Mutex
+
+	generation uint64
+	timer      *time.Timer
+	cancel     context.CancelFunc
+}
+
+func newDetectionScheduler(
+	ctx context.Context,
+	run func(ctx context.Context, uri, text string),
+) *detectionScheduler {
+	return &detectionScheduler{
+		ctx:     ctx,
+		run:     run,
+		workers: make(map[string]*detectionWorker),
+	}
+}
+
+// schedule runs detection for text after delay, superseding any pending or
+// in-flight run for the same URI.
+func (s *detectionScheduler) schedule(uri, text string, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.workers[uri]
+	if !ok {
+		w = &detectionWorker{}
+		s.workers[uri] = w
+	}
+	w.stop()
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	w.generation++
+	w.cancel = cancel
+
+	generation := w.generation
+	w.timer = time.AfterFunc(delay, func() {
+		w.running.Lock()
+		if ctx.Err() == nil {
+			s.run(ctx, uri, text)
+		}
+		w.running.Unlock()
+
+		s.finish(uri, w, generation)
+	})
+}
+
+// cancel drops the pending or in-flight run for uri, if any.
+func (s *detectionScheduler) cancel(uri string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if w, ok := s.workers[uri]; ok {
+		w.stop()
+		delete(s.workers, uri)
+	}
+}
+
+// finish drops the worker once its latest run has completed.
+func (s *detectionScheduler) finish(uri string, w *detectionWorker, generation uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.workers[uri] == w && w.generation == generation {
+		w.cancel()
+		delete(s.workers, uri)
+	}
+}
+
+// stop prevents the pending run from starting and cancels it if it already has.
+func (w *detectionWorker) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	if w.cancel != nil {
+		w.cancel()
+	}
+}
@@ -2,16 +2,24 @@ package lspproxy
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+	"go.trai.ch/yaml-schema-router/internal/yamldoc"
 )
 
 const (
+	componentInitialize   = "Initialize"
 	componentDidOpen      = "DidOpen"
-	componentDidChange    = "DidChange"
+	componentDetection    = "Detection"
 	componentEditorServer = "Editor -> Server"
 )
 
@@ -41,36 +49,103 @@ func (p *Proxy) handleEditorMessage(payload []byte) {
 	}
 
 	if msg.Method != "" {
-		if msg.Method == "textDocument/didOpen" ||
-			msg.Method == "textDocument/didChange" ||
-			msg.Method == "textDocument/didSave" {
-			log.Printf("[%s] Intercepting method: %s", componentEditorServer, msg.Method)
-		}
+		p.forwardToServer(p.handleEditorMethod(msg.Method, payload))
+		return
+	}
 
-		switch msg.Method {
-		case "textDocument/didOpen":
-			p.handleDidOpen(payload)
-		case "textDocument/didChange":
-			p.handleDidChange(payload)
+	// Responses to the server's own requests; error responses only end the tracking
+	if msg.ID != nil {
+		if items, ok := p.takeConfigurationRequest(msg.ID); ok && len(msg.Result) > 0 {
+			payload = p.interceptWorkspaceConfiguration(&msg, payload, items)
 		}
-		p.forwardToServer(payload)
+	}
+
+	p.forwardToServer(payload)
+}
+
+// handleEditorMethod inspects requests and notifications from the editor and
+// returns the payload to forward to the server.
+func (p *Proxy) handleEditorMethod(method string, payload []byte) []byte {
+	if method == "textDocument/didOpen" ||
+		method == "textDocument/didChange" ||
+		method == "textDocument/didSave" {
+		log.Printf("[%s] Intercepting method: %s", componentEditorServer, method)
+	}
+
+	switch method {
+	case "initialize":
+		p.handleInitialize(payload)
+	case "workspace/didChangeConfiguration":
+		return p.handleDidChangeConfiguration(payload)
+	case "textDocument/didOpen":
+		p.handleDidOpen(payload)
+	case "textDocument/didChange":
+		p.handleDidChange(payload)
+	case "textDocument/didSave":
+		p.handleDidSave(payload)
+	case "textDocument/didClose":
+		p.handleDidClose(payload)
+	}
+
+	return payload
+}
+
+// handleInitialize records whether the editor answers configuration pulls and
+// loads the project configuration layer from the workspace root it announces.
+func (p *Proxy) handleInitialize(payload []byte) {
+	var req InitializeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("Error unmarshaling initialize: %v", err)
 		return
 	}
 
-	if msg.ID != nil && len(msg.Result) > 0 {
-		payload = p.interceptWorkspaceConfiguration(&msg, payload)
+	p.pullConfiguration = req.Params.Capabilities.Workspace.Configuration
+	if !p.pullConfiguration {
+		log.Printf("[%s] Editor does not support workspace/configuration. Pushing settings instead.", componentInitialize)
 	}
 
-	p.forwardToServer(payload)
+	root := workspaceRoot(req.Params)
+	if root == "" {
+		log.Printf("[%s] Editor reported no workspace root. Skipping project configuration.", componentInitialize)
+		return
+	}
+
+	cfg, err := p.configLoader.Load(root)
+	if err != nil {
+		log.Printf("[%s] Failed to load project configuration: %v", componentInitialize, err)
+		return
+	}
+
+	// Detection has not started yet, so nothing uses the detector chain and
+	// registry built for the configuration the process was started with.
+	merged := p.config.WithProject(cfg)
+	chain, registry, err := p.components(merged)
+	if err != nil {
+		log.Printf("[%s] Failed to apply project configuration: %v", componentInitialize, err)
+		return
+	}
+
+	log.Printf("[%s] Loaded configuration for workspace %s", componentInitialize, root)
+
+	p.config, p.detectorChain, p.registry = merged, chain, registry
+	p.registry.OnChange(p.handleSchemaChange)
+	p.recent = newRecentDetections(merged.Detection.RecentCacheSize)
 }
 
-// triggerConfigurationPull sends an empty didChangeConfiguration notification
-// to force the yaml-language-server to request a configuration pull.
-func (p *Proxy) triggerConfigurationPull() {
-	log.Printf("[%s] Triggering configuration pull (sending workspace/didChangeConfiguration)", componentName)
-	// A barebones payload is enough to trigger the pullConfiguration() flow
-	payload := []byte(`{"jsonrpc":"2.0","method":"workspace/didChangeConfiguration"}`)
-	p.forwardToServer(payload)
+// workspaceRoot returns the local directory of the editor's workspace,
+// preferring rootUri over the first workspace folder and the deprecated rootPath.
+func workspaceRoot(params InitializeParams) string {
+	if path, ok := fileuri.ToPath(params.RootURI); ok {
+		return path
+	}
+
+	for _, folder := range params.WorkspaceFolders {
+		if path, ok := fileuri.ToPath(folder.URI); ok {
+			return path
+		}
+	}
+
+	return params.RootPath
 }
 
 func (p *Proxy) handleDidOpen(payload []byte) {
@@ -84,54 +159,97 @@ func (p *Proxy) handleDidOpen(payload []byte) {
 	text := notif.Params.TextDocument.Text
 
 	log.Printf("[%s] Processing file: %s", componentDidOpen, uri)
+	go p.detectorChain.FileChanged(uri)
 
-	if p.hasSchemaAnnotation(text) {
-		log.Printf("[%s] Manual schema annotation detected for %s. Bypassing router.", componentDidOpen, uri)
-		return
-	}
+	p.stateMutex.Lock()
+	p.openDocuments[uri] = text
+	p.stateMutex.Unlock()
 
-	schemaURLs, err := p.detectorChain.Run(uri, []byte(text))
-	if err != nil {
-		log.Printf("[%s] Error running detectors: %v", componentDidOpen, err)
+	if schemaURL, ok := p.recent.get(uri, text); ok {
+		log.Printf("[%s] Reusing recent detection for unchanged %s", componentDidOpen, uri)
+		p.updateSchemaState(uri, schemaURL)
 		return
 	}
 
-	if len(schemaURLs) == 0 {
-		log.Printf("[%s] No schema detected for %s", componentDidOpen, uri)
+	// Newly opened documents are detected right away, without debouncing.
+	p.detections.schedule(uri, text, 0)
+}
+
+func (p *Proxy) handleDidChange(payload []byte) {
+	var notif DidChangeNotification
+	if err := json.Unmarshal(payload, &notif); err != nil {
+		log.Printf("Error unmarshaling didChange: %v", err)
 		return
 	}
 
-	finalSchemaURL, err := p.registry.GenerateCompositeSchema(schemaURLs)
-	if err != nil {
-		log.Printf("[%s] Error generating composite schema: %v", componentDidOpen, err)
+	if len(notif.Params.ContentChanges) == 0 {
 		return
 	}
 
-	log.Printf("[%s] MATCH! Mapping %s -> %s", componentDidOpen, uri, finalSchemaURL)
+	uri := notif.Params.TextDocument.URI
+	text := notif.Params.ContentChanges[0].Text
 
 	p.stateMutex.Lock()
-	p.schemaState[uri] = finalSchemaURL
+	p.openDocuments[uri] = text
 	p.stateMutex.Unlock()
 
-	p.triggerConfigurationPull()
+	p.detections.schedule(uri, text, p.config.Detection.Debounce)
 }
 
-func (p *Proxy) handleDidChange(payload []byte) {
-	var notif DidChangeNotification
+// handleDidSave lets detectors indexing files on disk pick up the saved file.
+func (p *Proxy) handleDidSave(payload []byte) {
+	var notif DidSaveNotification
 	if err := json.Unmarshal(payload, &notif); err != nil {
-		log.Printf("Error unmarshaling didChange: %v", err)
+		log.Printf("Error unmarshaling didSave: %v", err)
 		return
 	}
 
-	if len(notif.Params.ContentChanges) == 0 {
+	go p.detectorChain.FileChanged(notif.Params.TextDocument.URI)
+}
+
+// handleDidClose stops tracking a closed document and releases its schema
+// mapping. Its last detection stays in the recent detections cache.
+func (p *Proxy) handleDidClose(payload []byte) {
+	var notif DidCloseNotification
+	if err := json.Unmarshal(payload, &notif); err != nil {
+		log.Printf("Error unmarshaling didClose: %v", err)
 		return
 	}
 
 	uri := notif.Params.TextDocument.URI
-	text := notif.Params.ContentChanges[0].Text
+	p.detections.cancel(uri)
 
-	if p.hasSchemaAnnotation(text) {
-		p.clearSchemaState(uri, fmt.Sprintf("Manual schema annotation added to %s", uri))
+	p.stateMutex.Lock()
+	delete(p.openDocuments, uri)
+	p.stateMutex.Unlock()
+
+	p.clearSchemaState(uri, fmt.Sprintf("Document %s closed", uri))
+}
+
+// handleSchemaChange re-detects every open document after a cached schema
+// was updated and makes the language server reload its schemas, which it
+// keeps for as long as their URIs don't change. Wrappers and composites
+// reference their members by URI, so they pick up the new content as is.
+func (p *Proxy) handleSchemaChange(cachePath string) {
+	log.Printf("[%s] Schema %s changed, re-detecting open documents", componentDetection, cachePath)
+
+	p.stateMutex.RLock()
+	documents := maps.Clone(p.openDocuments)
+	p.stateMutex.RUnlock()
+
+	for uri, text := range documents {
+		p.detections.schedule(uri, text, 0)
+	}
+
+	p.scheduleConfigurationUpdate()
+}
+
+// detectDocument runs the detector chain for one document revision and
+// updates the router state. It is invoked by the detection scheduler, and
+// discards its result if a newer revision superseded it in the meantime.
+func (p *Proxy) detectDocument(ctx context.Context, uri, text string) {
+	if _, annotated := detector.SchemaAnnotation([]byte(text)); annotated {
+		p.clearSchemaState(uri, fmt.Sprintf("Manual schema annotation detected for %s", uri))
 		return
 	}
 
@@ -140,35 +258,51 @@ func (p *Proxy) handleDidChange(payload []byte) {
 		return
 	}
 
-	schemaURLs, err := p.detectorChain.Run(uri, []byte(text))
+	matches, err := p.detectorChain.Run(ctx, uri, []byte(text))
 	if err != nil {
-		log.Printf("[%s] Error running detectors: %v", componentDidChange, err)
+		if ctx.Err() == nil {
+			log.Printf("[%s] Error running detectors: %v", componentDetection, err)
+		}
 		return
 	}
 
-	if len(schemaURLs) == 0 {
+	if len(matches) == 0 {
 		// TODO: If we lose detection (e.g. user deletes the apiVersion line), strictly we might want to
 		// remove it from state, but for now we just return.
+		log.Printf("[%s] No schema detected for %s", componentDetection, uri)
 		return
 	}
 
-	finalSchemaURL, err := p.registry.GenerateCompositeSchema(schemaURLs)
+	members := make([]schemaregistry.CompositeMember, 0, len(matches))
+	for _, m := range matches {
+		members = append(members, schemaregistry.CompositeMember{
+			URI: m.SchemaURI, Discriminator: m.Discriminator, StartLine: m.StartLine,
+		})
+	}
+
+	finalSchemaURL, err := p.registry.GenerateCompositeSchema(members, len(yamldoc.Split([]byte(text))))
 	if err != nil {
-		log.Printf("[%s] Error generating composite schema: %v", componentDidChange, err)
+		log.Printf("[%s] Error generating composite schema: %v", componentDetection, err)
+		return
+	}
+
+	if ctx.Err() != nil {
+		log.Printf("[%s] Discarding stale detection result for %s", componentDetection, uri)
 		return
 	}
 
+	p.recent.put(uri, text, finalSchemaURL)
 	p.updateSchemaState(uri, finalSchemaURL)
 }
 
 func (p *Proxy) clearSchemaState(uri, reason string) {
 	p.stateMutex.Lock()
 	if _, exists := p.schemaState[uri]; exists {
-		log.Printf("[%s] %s. Removing from router state.", componentDidChange, reason)
+		log.Printf("[%s] %s. Removing from router state.", componentDetection, reason)
 		delete(p.schemaState, uri)
 		p.stateMutex.Unlock()
 
-		p.triggerConfigurationPull()
+		p.scheduleConfigurationUpdate()
 	} else {
 		p.stateMutex.Unlock()
 	}
@@ -176,13 +310,19 @@ func (p *Proxy) clearSchemaState(uri, reason string) {
 
 func (p *Proxy) updateSchemaState(uri, newSchemaURL string) {
 	p.stateMutex.Lock()
+	// A detection that finished after its document was closed must not resurrect it
+	if _, open := p.openDocuments[uri]; !open {
+		p.stateMutex.Unlock()
+		return
+	}
+
 	// Only trigger a configuration pull if the schema actually changed
 	if p.schemaState[uri] != newSchemaURL {
-		log.Printf("[%s] Schema changed for %s! New: %s", componentDidChange, uri, newSchemaURL)
+		log.Printf("[%s] Schema changed for %s! New: %s", componentDetection, uri, newSchemaURL)
 		p.schemaState[uri] = newSchemaURL
 		p.stateMutex.Unlock()
 
-		p.triggerConfigurationPull()
+		p.scheduleConfigurationUpdate()
 	} else {
 		p.stateMutex.Unlock()
 	}
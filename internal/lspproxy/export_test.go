@@ -0,0 +1,4 @@
+package lspproxy
+
+// MergeSchemas exposes mergeSchemas to the tests.
+var MergeSchemas = mergeSchemas
@@ -0,0 +1,199 @@
+package lspproxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+const (
+	// handshakeRequestID is the ID of the initialize request Handshake sends.
+	handshakeRequestID = 1
+
+	// shutdownGracePeriod is how long Handshake waits for the server to exit
+	// after the exit notification before killing it.
+	shutdownGracePeriod = 2 * time.Second
+
+	// maxStderrExcerpt is how much of the server's stderr errors include.
+	maxStderrExcerpt = 2048
+)
+
+// ServerInfo is what a language server reported in its initialize response.
+type ServerInfo struct {
+	// Name and Version are empty if the server does not report them.
+	Name    string
+	Version string
+
+	// TextDocumentSync is set if the server advertised document
+	// synchronization, which the proxy rewrites to full sync.
+	TextDocumentSync bool
+}
+
+type initializeResult struct {
+	Capabilities map[string]json.RawMessage `json:"capabilities"`
+	ServerInfo   *struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"serverInfo"`
+}
+
+// Handshake spawns the configured language server like Proxy.Start does,
+// sends it an initialize request for rootURI and shuts it down again. Errors
+// include what the server wrote to stderr.
+func Handshake(ctx context.Context, cfg *config.Config, rootURI string) (*ServerInfo, error) {
+	//nolint:gosec // LSPPath is provided via a trusted command-line flag or config file
+	cmd := exec.CommandContext(ctx, cfg.LSPPath, cfg.LSPArgs...)
+	cmd.WaitDelay = shutdownGracePeriod
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	serverIn, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	serverOut, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start language server (%s): %w", cfg.LSPPath, err)
+	}
+
+	info, err := initialize(ctx, serverIn, serverOut, rootURI)
+
+	// Ask the server to exit and give it a moment before it is killed
+	_ = writeLSPMessage(serverIn, map[string]any{"jsonrpc": "2.0", "id": handshakeRequestID + 1, "method": "shutdown"})
+	_ = writeLSPMessage(serverIn, map[string]any{"jsonrpc": "2.0", "method": "exit"})
+	_ = serverIn.Close()
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(shutdownGracePeriod):
+		_ = cmd.Process.Kill()
+		<-exited
+	}
+
+	if err != nil {
+		if excerpt := stderrExcerpt(stderr.String()); excerpt != "" {
+			return nil, fmt.Errorf("%w\n%s", err, excerpt)
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// initialize sends the initialize request and waits for its response,
+// skipping the notifications and requests the server sends meanwhile.
+func initialize(ctx context.Context, serverIn io.Writer, serverOut io.Reader, rootURI string) (*ServerInfo, error) {
+	request := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      handshakeRequestID,
+		"method":  "initialize",
+		"params": map[string]any{
+			"processId":    os.Getpid(),
+			"rootUri":      rootURI,
+			"capabilities": map[string]any{},
+		},
+	}
+	if err := writeLSPMessage(serverIn, request); err != nil {
+		return nil, fmt.Errorf("failed to send initialize request: %w", err)
+	}
+
+	type response struct {
+		msg BaseRPC
+		err error
+	}
+	responses := make(chan response, 1)
+	go func() {
+		// Keep reading until the server exits, so it never blocks on a full pipe
+		answered := false
+		reader := bufio.NewReader(serverOut)
+		for {
+			payload, err := readLSPMessage(reader)
+			if err != nil {
+				if !answered {
+					if errors.Is(err, io.EOF) {
+						err = errors.New("language server exited before answering initialize")
+					}
+					responses <- response{err: err}
+				}
+				return
+			}
+
+			var msg BaseRPC
+			if !answered && json.Unmarshal(payload, &msg) == nil && msg.Method == "" &&
+				requestKey(msg.ID) == requestKey(float64(handshakeRequestID)) {
+				answered = true
+				responses <- response{msg: msg}
+			}
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no initialize response: %w", ctx.Err())
+	case resp := <-responses:
+		if resp.err != nil {
+			return nil, resp.err
+		}
+		return parseInitializeResponse(resp.msg)
+	}
+}
+
+func parseInitializeResponse(msg BaseRPC) (*ServerInfo, error) {
+	if len(msg.Error) > 0 {
+		return nil, fmt.Errorf("initialize failed: %s", msg.Error)
+	}
+
+	var result initializeResult
+	if err := json.Unmarshal(msg.Result, &result); err != nil {
+		return nil, fmt.Errorf("invalid initialize response: %w", err)
+	}
+	if result.Capabilities == nil {
+		return nil, errors.New("initialize response has no capabilities")
+	}
+
+	info := &ServerInfo{}
+	_, info.TextDocumentSync = result.Capabilities["textDocumentSync"]
+	if result.ServerInfo != nil {
+		info.Name = result.ServerInfo.Name
+		info.Version = result.ServerInfo.Version
+	}
+	return info, nil
+}
+
+// writeLSPMessage serializes msg and writes it with its header.
+func writeLSPMessage(w io.Writer, msg any) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(payload), payload)
+	return err
+}
+
+// stderrExcerpt returns the end of the server's stderr output.
+func stderrExcerpt(stderr string) string {
+	stderr = strings.TrimSpace(stderr)
+	if len(stderr) > maxStderrExcerpt {
+		stderr = "..." + stderr[len(stderr)-maxStderrExcerpt:]
+	}
+	return stderr
+}
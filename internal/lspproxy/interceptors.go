@@ -8,61 +8,48 @@ import (
 	"go.trai.ch/yaml-schema-router/internal/config"
 )
 
-const maxSchemaScanLines = 10
-
-// hasSchemaAnnotation checks if the provided text contains a manual schema
-// annotation (e.g., `# yaml-language-server: $schema=`) in the first few lines.
-func (p *Proxy) hasSchemaAnnotation(text string) bool {
-	lines := strings.SplitN(text, "\n", maxSchemaScanLines)
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		// Check if the line is exactly the modeline format
-		if strings.HasPrefix(trimmed, "# yaml-language-server: $schema=") {
-			return true
-		}
-	}
-	return false
-}
+const (
+	// yamlSection is the configuration section holding the yaml-language-server settings.
+	yamlSection = "yaml"
+)
 
 // interceptWorkspaceConfiguration dynamically injects schema configurations
-// into the editor's response to the language server.
-func (p *Proxy) interceptWorkspaceConfiguration(msg *BaseRPC, payload []byte) []byte {
+// into the editor's response to a workspace/configuration request. Only the
+// result items answering a "yaml" section request are modified.
+func (p *Proxy) interceptWorkspaceConfiguration(
+	msg *BaseRPC,
+	payload []byte,
+	items []ConfigurationItem,
+) []byte {
 	var result []any
-	if err := json.Unmarshal(msg.Result, &result); err != nil || len(result) == 0 {
+	if err := json.Unmarshal(msg.Result, &result); err != nil || len(result) != len(items) {
 		return payload
 	}
 
-	// Ensure we have a map to work with, even if the editor returned null.
-	if result[0] == nil {
-		result[0] = make(map[string]any)
-	}
-
-	// The first item in the array is the "yaml" section requested by the server
-	yamlConfig, ok := result[0].(map[string]any)
-	if !ok {
-		return payload
-	}
+	injected := false
+	for i, item := range items {
+		if item.Section != yamlSection {
+			continue
+		}
 
-	modified := injectFeatureDefaults(yamlConfig)
+		// Ensure we have a map to work with, even if the editor returned null.
+		if result[i] == nil {
+			result[i] = make(map[string]any)
+		}
 
-	groupedSchemas := p.getGroupedSchemas()
+		yamlConfig, ok := result[i].(map[string]any)
+		if !ok {
+			continue
+		}
 
-	// If no schemas are detected yet, return unmodified payload
-	if len(groupedSchemas) == 0 {
-		log.Printf("[%s] Intercepted workspace/configuration, but no schemas detected to inject.", componentName)
-		modified = true
+		p.injectYAMLConfig(yamlConfig, item.ScopeURI)
+		injected = true
 	}
 
-	if !modified {
+	if !injected {
 		return payload
 	}
 
-	log.Printf("[%s] Injecting schemas into workspace/configuration: %v", componentName, groupedSchemas)
-
-	// Inject our schemas into Helix's response
-	yamlConfig["schemas"] = groupedSchemas
-	result[0] = yamlConfig
-
 	newResult, err := json.Marshal(result)
 	if err != nil {
 		log.Printf("[%s] Error re-marshaling configuration result: %v", componentName, err)
@@ -79,34 +66,60 @@ func (p *Proxy) interceptWorkspaceConfiguration(msg *BaseRPC, payload []byte) []
 	return modifiedPayload
 }
 
-func injectFeatureDefaults(yamlConfig map[string]any) bool {
-	modified := false
+// injectYAMLConfig adds the feature defaults and the router's schemas for
+// documents inside scopeURI to a yaml settings section.
+func (p *Proxy) injectYAMLConfig(yamlConfig map[string]any, scopeURI string) {
+	injectFeatureDefaults(yamlConfig, p.config.Features)
+
+	groupedSchemas := p.getGroupedSchemas(scopeURI)
+	if len(groupedSchemas) == 0 {
+		log.Printf("[%s] Intercepted workspace/configuration, but no schemas detected to inject.", componentName)
+	} else {
+		log.Printf("[%s] Injecting schemas into workspace/configuration: %v", componentName, groupedSchemas)
+	}
+
+	// Merge our schemas with the ones configured in the editor's response
+	yamlConfig["schemas"] = mergeSchemas(yamlConfig["schemas"], groupedSchemas, p.config.Schemas.ConflictPolicy)
+}
+
+func injectFeatureDefaults(yamlConfig map[string]any, features config.FeatureConfig) {
 	featureDefaults := map[string]bool{
-		"hover":      config.DefaultHover,
-		"completion": config.DefaultCompletion,
-		"validation": config.DefaultValidation,
+		"hover":      features.Hover,
+		"completion": features.Completion,
+		"validation": features.Validation,
 	}
 
 	// Inject defaults only if the key does not already exist in the user's config.
 	for key, defaultValue := range featureDefaults {
 		if _, exists := yamlConfig[key]; !exists {
 			yamlConfig[key] = defaultValue
-			modified = true
 		}
 	}
-	return modified
 }
 
-func (p *Proxy) getGroupedSchemas() map[string][]string {
+// getGroupedSchemas inverts the router state into schema -> URIs, limited to
+// documents inside scopeURI. An empty scope includes every document.
+func (p *Proxy) getGroupedSchemas(scopeURI string) map[string][]string {
 	p.stateMutex.RLock()
 	defer p.stateMutex.RUnlock()
 	groupedSchemas := make(map[string][]string)
 	for uri, schemaURL := range p.schemaState {
+		if !inScope(uri, scopeURI) {
+			continue
+		}
 		groupedSchemas[schemaURL] = append(groupedSchemas[schemaURL], uri)
 	}
 	return groupedSchemas
 }
 
+// inScope reports whether uri is scopeURI itself or lies inside it.
+func inScope(uri, scopeURI string) bool {
+	if scopeURI == "" || uri == scopeURI {
+		return true
+	}
+	return strings.HasPrefix(uri, strings.TrimSuffix(scopeURI, "/")+"/")
+}
+
 // forceFullSync intercepts the 'initialize' response from the language server
 // and overwrites the textDocumentSync capability to 1 (Full Sync).
 func (p *Proxy) forceFullSync(payload []byte) []byte {
@@ -4,6 +4,7 @@ package lspproxy
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -11,6 +12,7 @@ import (
 	"os/exec"
 	"sync"
 
+	"go.trai.ch/yaml-schema-router/internal/config"
 	"go.trai.ch/yaml-schema-router/internal/detector"
 	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
 )
@@ -26,31 +28,77 @@ type Proxy struct {
 	serverIn  io.WriteCloser
 	serverOut io.ReadCloser
 
-	lspPath       string
+	// serverInMutex serializes writes to the server, which now come from both
+	// the editor loop and the detection workers.
+	serverInMutex sync.Mutex
+
+	config        *config.Config
+	configLoader  *config.Loader
+	components    Components
 	detectorChain *detector.Chain
 	registry      *schemaregistry.Registry
+	detections    *detectionScheduler
+	recent        *recentDetections
 
 	// schemaState tracks URI -> applied Schema URL to prevent redundant updates
 	schemaState map[string]string
-	stateMutex  sync.RWMutex
+	// openDocuments tracks URI -> latest text of every document open in the editor
+	openDocuments map[string]string
+	stateMutex    sync.RWMutex
+
+	// updatePending is set while a coalesced configuration update is scheduled.
+	updatePending bool
+	updateMutex   sync.Mutex
+
+	// pullConfiguration is true when the editor answers workspace/configuration
+	// requests. Otherwise settings are pushed with workspace/didChangeConfiguration.
+	// It is set while handling initialize, before any detection runs.
+	pullConfiguration bool
+
+	// editorSettings holds the last settings the editor pushed itself.
+	editorSettings json.RawMessage
+	settingsMutex  sync.Mutex
+
+	// pendingConfigRequests tracks the items of workspace/configuration
+	// requests sent by the server, keyed by request ID, until the editor answers.
+	pendingConfigRequests map[string][]ConfigurationItem
+	pendingMutex          sync.Mutex
 }
 
-// NewProxy initializes the structs and prepares the subprocess.
-func NewProxy(lspPath string, chain *detector.Chain, registry *schemaregistry.Registry) *Proxy {
+// Components builds the detector chain and schema registry the proxy routes
+// documents with for a configuration.
+type Components func(cfg *config.Config) (*detector.Chain, *schemaregistry.Registry, error)
+
+// NewProxy initializes the structs and prepares the subprocess. The detector
+// chain and registry are built for cfg through components; once the editor
+// reports its workspace root, the project layer is loaded through loader and
+// they are built again for the merged configuration.
+func NewProxy(cfg *config.Config, loader *config.Loader, components Components) (*Proxy, error) {
+	chain, registry, err := components(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Proxy{
 		editorIn:      os.Stdin,
 		editorOut:     os.Stdout,
-		lspPath:       lspPath,
+		config:        cfg,
+		configLoader:  loader,
+		components:    components,
 		detectorChain: chain,
 		registry:      registry,
+		recent:        newRecentDetections(cfg.Detection.RecentCacheSize),
 		schemaState:   make(map[string]string),
-	}
+		openDocuments: make(map[string]string),
+
+		pendingConfigRequests: make(map[string][]ConfigurationItem),
+	}, nil
 }
 
 // Start launches the yaml-language-server and begins proxying traffic.
 func (p *Proxy) Start(ctx context.Context) error {
-	//nolint:gosec // lspPath is provided via a trusted command-line flag
-	p.serverCmd = exec.Command(p.lspPath, "--stdio")
+	//nolint:gosec // LSPPath is provided via a trusted command-line flag or config file
+	p.serverCmd = exec.Command(p.config.LSPPath, p.config.LSPArgs...)
 
 	serverIn, inErr := p.serverCmd.StdinPipe()
 	if inErr != nil {
@@ -67,11 +115,14 @@ func (p *Proxy) Start(ctx context.Context) error {
 	p.serverCmd.Stderr = os.Stderr
 
 	if err := p.serverCmd.Start(); err != nil {
-		return fmt.Errorf("failed to start language server (%s): %w", p.lspPath, err)
+		return fmt.Errorf("failed to start language server (%s): %w", p.config.LSPPath, err)
 	}
 
 	log.Printf("[%s] Language server started (PID: %d)", componentName, p.serverCmd.Process.Pid)
 
+	p.detections = newDetectionScheduler(ctx, p.detectDocument)
+	p.registry.OnChange(p.handleSchemaChange)
+
 	var wg sync.WaitGroup
 
 	wg.Go(func() {
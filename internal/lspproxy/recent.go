@@ -0,0 +1,81 @@
+package lspproxy
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+// recentDetections is a bounded LRU of detection results keyed by URI and
+// content hash, so reopening a recently closed document is instant.
+type recentDetections struct {
+	capacity int
+
+	mu      sync.Mutex
+	order   *list.List // front = most recently used
+	entries map[string]*list.Element
+}
+
+type recentDetection struct {
+	uri         string
+	contentHash [sha256.Size]byte
+	schemaURL   string
+}
+
+// newRecentDetections creates an LRU holding up to capacity entries. A
+// capacity of zero disables it.
+func newRecentDetections(capacity int) *recentDetections {
+	return &recentDetections{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get returns the schema detected for uri if its content is unchanged.
+func (r *recentDetections) get(uri, text string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.entries[uri]
+	if !ok {
+		return "", false
+	}
+
+	entry, _ := elem.Value.(*recentDetection)
+	if entry.contentHash != sha256.Sum256([]byte(text)) {
+		return "", false
+	}
+
+	r.order.MoveToFront(elem)
+	return entry.schemaURL, true
+}
+
+// put records the schema detected for a document revision, evicting the
+// least recently used entry when full.
+func (r *recentDetections) put(uri, text, schemaURL string) {
+	if r.capacity <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry := &recentDetection{uri: uri, contentHash: sha256.Sum256([]byte(text)), schemaURL: schemaURL}
+
+	if elem, ok := r.entries[uri]; ok {
+		elem.Value = entry
+		r.order.MoveToFront(elem)
+		return
+	}
+
+	r.entries[uri] = r.order.PushFront(entry)
+
+	if r.order.Len() > r.capacity {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		if evicted, ok := oldest.Value.(*recentDetection); ok {
+			delete(r.entries, evicted.uri)
+		}
+	}
+}
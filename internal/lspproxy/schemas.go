@@ -0,0 +1,145 @@
+package lspproxy
+
+import (
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/glob"
+)
+
+// mergeSchemas combines the user's yaml.schemas setting with the router's
+// schema -> URIs mappings according to policy. The user's value may map a
+// schema to a single pattern or to a list of patterns.
+func mergeSchemas(userSchemas any, routed map[string][]string, policy string) map[string]any {
+	user := normalizeSchemas(userSchemas)
+
+	switch policy {
+	case config.SchemaPolicyUser:
+		routed = withoutUserMatches(routed, user)
+	case config.SchemaPolicyRouter:
+		user = withoutRoutedMatches(user, routed)
+	case config.SchemaPolicyMerge:
+	default:
+		log.Printf("[%s] Unknown schema conflict policy %q. Falling back to %q.",
+			componentName, policy, config.SchemaPolicyMerge)
+	}
+
+	merged := make(map[string]any, len(user)+len(routed))
+	for schema, patterns := range user {
+		merged[schema] = patterns
+	}
+	for schema, uris := range routed {
+		existing, _ := merged[schema].([]string)
+		for _, uri := range uris {
+			if !slices.Contains(existing, uri) {
+				existing = append(existing, uri)
+			}
+		}
+		merged[schema] = existing
+	}
+
+	return merged
+}
+
+// normalizeSchemas converts a yaml.schemas value into schema -> patterns,
+// skipping entries that are neither a string nor a list of strings.
+func normalizeSchemas(value any) map[string][]string {
+	raw, ok := value.(map[string]any)
+	if !ok {
+		return map[string][]string{}
+	}
+
+	schemas := make(map[string][]string, len(raw))
+	for schema, patterns := range raw {
+		switch v := patterns.(type) {
+		case string:
+			schemas[schema] = []string{v}
+		case []any:
+			for _, item := range v {
+				if pattern, ok := item.(string); ok {
+					schemas[schema] = append(schemas[schema], pattern)
+				}
+			}
+		default:
+			log.Printf("[%s] Ignoring invalid yaml.schemas entry for %s", componentName, schema)
+		}
+	}
+
+	return schemas
+}
+
+// withoutUserMatches drops routed URIs already covered by a user pattern.
+func withoutUserMatches(routed, user map[string][]string) map[string][]string {
+	filtered := make(map[string][]string, len(routed))
+	for schema, uris := range routed {
+		for _, uri := range uris {
+			if !anyPatternMatches(user, uri) {
+				filtered[schema] = append(filtered[schema], uri)
+			}
+		}
+	}
+	return filtered
+}
+
+// withoutRoutedMatches drops user patterns that match any routed URI.
+func withoutRoutedMatches(user, routed map[string][]string) map[string][]string {
+	filtered := make(map[string][]string, len(user))
+	for schema, patterns := range user {
+		for _, pattern := range patterns {
+			if !patternMatchesAny(pattern, routed) {
+				filtered[schema] = append(filtered[schema], pattern)
+			}
+		}
+	}
+	return filtered
+}
+
+func anyPatternMatches(schemas map[string][]string, uri string) bool {
+	for _, patterns := range schemas {
+		for _, pattern := range patterns {
+			if patternMatchesURI(pattern, uri) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func patternMatchesAny(pattern string, schemas map[string][]string) bool {
+	for _, uris := range schemas {
+		for _, uri := range uris {
+			if patternMatchesURI(pattern, uri) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// patternMatchesURI approximates the yaml-language-server's file matching:
+// URI patterns are matched against the URI, relative patterns may match at
+// any depth of the file's path.
+func patternMatchesURI(pattern, uri string) bool {
+	if pattern == uri {
+		return true
+	}
+
+	if strings.Contains(pattern, "://") {
+		return glob.Match(pattern, uri)
+	}
+
+	path, ok := fileuri.ToPath(uri)
+	if !ok {
+		return false
+	}
+
+	if !strings.HasPrefix(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	return glob.Match(pattern, filepath.ToSlash(path))
+}
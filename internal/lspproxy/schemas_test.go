@@ -0,0 +1,101 @@
+package lspproxy_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/lspproxy"
+)
+
+const (
+	appURI   = "file:///work/deploy/app.yaml"
+	otherURI = "file:///work/other.yaml"
+)
+
+func TestMergeSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		user   any
+		routed map[string][]string
+		policy string
+		want   map[string]any
+	}{
+		{
+			name:   "no user schemas",
+			user:   nil,
+			routed: map[string][]string{"deployment.json": {appURI}},
+			policy: config.SchemaPolicyMerge,
+			want:   map[string]any{"deployment.json": []string{appURI}},
+		},
+		{
+			name:   "single pattern and pattern lists",
+			user:   map[string]any{"a.json": "*.a.yaml", "b.json": []any{"*.b.yaml", 42, "*.bb.yaml"}},
+			routed: map[string][]string{},
+			policy: config.SchemaPolicyMerge,
+			want:   map[string]any{"a.json": []string{"*.a.yaml"}, "b.json": []string{"*.b.yaml", "*.bb.yaml"}},
+		},
+		{
+			name:   "invalid user entries",
+			user:   map[string]any{"a.json": 42},
+			routed: map[string][]string{"deployment.json": {appURI}},
+			policy: config.SchemaPolicyMerge,
+			want:   map[string]any{"deployment.json": []string{appURI}},
+		},
+		{
+			name:   "merge keeps both",
+			user:   map[string]any{"custom.json": "app.yaml"},
+			routed: map[string][]string{"deployment.json": {appURI}},
+			policy: config.SchemaPolicyMerge,
+			want:   map[string]any{"custom.json": []string{"app.yaml"}, "deployment.json": []string{appURI}},
+		},
+		{
+			name:   "merge into the same schema",
+			user:   map[string]any{"deployment.json": []any{"*.k8s.yaml", appURI}},
+			routed: map[string][]string{"deployment.json": {appURI, otherURI}},
+			policy: config.SchemaPolicyMerge,
+			want:   map[string]any{"deployment.json": []string{"*.k8s.yaml", appURI, otherURI}},
+		},
+		{
+			name:   "user wins",
+			user:   map[string]any{"custom.json": "deploy/*.yaml"},
+			routed: map[string][]string{"deployment.json": {appURI, otherURI}},
+			policy: config.SchemaPolicyUser,
+			want:   map[string]any{"custom.json": []string{"deploy/*.yaml"}, "deployment.json": []string{otherURI}},
+		},
+		{
+			name:   "user URI pattern wins",
+			user:   map[string]any{"custom.json": "file:///work/**"},
+			routed: map[string][]string{"deployment.json": {appURI, otherURI}},
+			policy: config.SchemaPolicyUser,
+			want:   map[string]any{"custom.json": []string{"file:///work/**"}},
+		},
+		{
+			name:   "router wins",
+			user:   map[string]any{"custom.json": []any{"app.yaml", "*.k8s.yaml"}, "other.json": "/work/*.yaml"},
+			routed: map[string][]string{"deployment.json": {appURI}},
+			policy: config.SchemaPolicyRouter,
+			want: map[string]any{
+				"custom.json":     []string{"*.k8s.yaml"},
+				"other.json":      []string{"/work/*.yaml"},
+				"deployment.json": []string{appURI},
+			},
+		},
+		{
+			name:   "unknown policy merges",
+			user:   map[string]any{"custom.json": "app.yaml"},
+			routed: map[string][]string{"deployment.json": {appURI}},
+			policy: "newest",
+			want:   map[string]any{"custom.json": []string{"app.yaml"}, "deployment.json": []string{appURI}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lspproxy.MergeSchemas(tt.user, tt.routed, tt.policy)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeSchemas() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,9 +2,11 @@ package lspproxy
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"strings"
 )
 
 // processServerToEditor continuously reads from the language server,
@@ -23,6 +25,8 @@ func (p *Proxy) processServerToEditor() {
 			log.Fatalf("[%s] Fatal error reading header from server: %v", componentName, err)
 		}
 
+		p.trackConfigurationRequest(payload)
+
 		// Intercept and optionally rewrite the payload
 		modifiedPayload := p.forceFullSync(payload)
 
@@ -38,3 +42,40 @@ func (p *Proxy) processServerToEditor() {
 		}
 	}
 }
+
+// trackConfigurationRequest remembers the items of a workspace/configuration
+// request so the editor's response can be correlated with it.
+func (p *Proxy) trackConfigurationRequest(payload []byte) {
+	// Fast path: avoid JSON unmarshaling for everything else.
+	if !strings.Contains(string(payload), `"workspace/configuration"`) {
+		return
+	}
+
+	var req ConfigurationRequest
+	if err := json.Unmarshal(payload, &req); err != nil ||
+		req.Method != "workspace/configuration" || req.ID == nil {
+		return
+	}
+
+	p.pendingMutex.Lock()
+	p.pendingConfigRequests[requestKey(req.ID)] = req.Params.Items
+	p.pendingMutex.Unlock()
+}
+
+// takeConfigurationRequest returns and forgets the items of the
+// workspace/configuration request with the given ID, if there is one.
+func (p *Proxy) takeConfigurationRequest(id any) ([]ConfigurationItem, bool) {
+	p.pendingMutex.Lock()
+	defer p.pendingMutex.Unlock()
+
+	key := requestKey(id)
+	items, ok := p.pendingConfigRequests[key]
+	delete(p.pendingConfigRequests, key)
+	return items, ok
+}
+
+// requestKey turns a JSON-RPC ID into a map key that keeps numeric and
+// string IDs apart.
+func requestKey(id any) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
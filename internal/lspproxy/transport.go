@@ -55,6 +55,9 @@ func readLSPMessage(reader *bufio.Reader) ([]byte, error) {
 func (p *Proxy) forwardToServer(payload []byte) {
 	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(payload))
 
+	p.serverInMutex.Lock()
+	defer p.serverInMutex.Unlock()
+
 	if _, err := p.serverIn.Write([]byte(header)); err != nil {
 		log.Printf("[%s] Error writing header to server: %v", componentName, err)
 		return
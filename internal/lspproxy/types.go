@@ -15,6 +15,50 @@ type BaseRPC struct {
 	Error   json.RawMessage `json:"error,omitempty"`
 }
 
+// InitializeRequest represents an incoming initialize LSP request.
+type InitializeRequest struct {
+	Method string           `json:"method"`
+	Params InitializeParams `json:"params"`
+}
+
+// InitializeParams holds the workspace information of an initialize request.
+type InitializeParams struct {
+	RootURI          string             `json:"rootUri"`
+	RootPath         string             `json:"rootPath"`
+	WorkspaceFolders []WorkspaceFolder  `json:"workspaceFolders"`
+	Capabilities     ClientCapabilities `json:"capabilities"`
+}
+
+// ClientCapabilities holds the editor capabilities relevant to the router.
+type ClientCapabilities struct {
+	Workspace WorkspaceClientCapabilities `json:"workspace"`
+}
+
+// WorkspaceClientCapabilities reports whether the editor answers
+// workspace/configuration requests.
+type WorkspaceClientCapabilities struct {
+	Configuration bool `json:"configuration"`
+}
+
+// WorkspaceFolder identifies one root folder opened in the editor.
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+// DidChangeConfigurationNotification represents an incoming
+// workspace/didChangeConfiguration LSP message.
+type DidChangeConfigurationNotification struct {
+	JSONRPC string                       `json:"jsonrpc"`
+	Method  string                       `json:"method"`
+	Params  DidChangeConfigurationParams `json:"params"`
+}
+
+// DidChangeConfigurationParams holds the settings pushed by the editor.
+type DidChangeConfigurationParams struct {
+	Settings json.RawMessage `json:"settings,omitempty"`
+}
+
 // DidOpenNotification represents an incoming textDocument/didOpen LSP message.
 type DidOpenNotification struct {
 	Method string        `json:"method"`
@@ -44,6 +88,28 @@ type DidChangeParams struct {
 	ContentChanges []TextDocumentContentChangeEvent `json:"contentChanges"`
 }
 
+// DidCloseNotification represents an incoming textDocument/didClose LSP message.
+type DidCloseNotification struct {
+	Method string         `json:"method"`
+	Params DidCloseParams `json:"params"`
+}
+
+// DidCloseParams holds the parameters for a textDocument/didClose notification.
+type DidCloseParams struct {
+	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+}
+
+// DidSaveNotification represents an incoming textDocument/didSave LSP message.
+type DidSaveNotification struct {
+	Method string        `json:"method"`
+	Params DidSaveParams `json:"params"`
+}
+
+// DidSaveParams holds the parameters for a textDocument/didSave notification.
+type DidSaveParams struct {
+	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+}
+
 // VersionedTextDocumentIdentifier identifies a specific document by its URI.
 type VersionedTextDocumentIdentifier struct {
 	URI string `json:"uri"`
@@ -53,3 +119,25 @@ type VersionedTextDocumentIdentifier struct {
 type TextDocumentContentChangeEvent struct {
 	Text string `json:"text"`
 }
+
+// --- Inbound from Server ---
+
+// ConfigurationRequest represents an outgoing workspace/configuration request
+// sent by the language server to the editor.
+type ConfigurationRequest struct {
+	ID     any                 `json:"id"`
+	Method string              `json:"method"`
+	Params ConfigurationParams `json:"params"`
+}
+
+// ConfigurationParams lists the configuration items the server asks for.
+type ConfigurationParams struct {
+	Items []ConfigurationItem `json:"items"`
+}
+
+// ConfigurationItem identifies one requested configuration section. The
+// editor's response holds one result per item, in the same order.
+type ConfigurationItem struct {
+	ScopeURI string `json:"scopeUri,omitempty"`
+	Section  string `json:"section,omitempty"`
+}
@@ -0,0 +1,134 @@
+// Package openapi converts the OpenAPI v3 schemas published by Kubernetes,
+// in CRD manifests and by API servers, into JSON Schema.
+package openapi
+
+import "strings"
+
+// Keywords of structural schemas that JSON Schema does not understand.
+const (
+	keyNullable           = "nullable"
+	keyIntOrString        = "x-kubernetes-int-or-string"
+	keyPreserveUnknown    = "x-kubernetes-preserve-unknown-fields"
+	keyAdditionalProperty = "additionalProperties"
+	keyRef                = "$ref"
+
+	formatIntOrString = "int-or-string"
+
+	// componentsPrefix starts references between the schemas of an OpenAPI
+	// document, which become JSON Schema definitions.
+	componentsPrefix  = "#/components/schemas/"
+	definitionsPrefix = "#/definitions/"
+)
+
+// schemaKeywordsWithSubschema hold a single subschema.
+var schemaKeywordsWithSubschema = []string{"items", "not", keyAdditionalProperty}
+
+// schemaKeywordsWithSubschemaList hold a list of subschemas.
+var schemaKeywordsWithSubschemaList = []string{"allOf", "anyOf", "oneOf"}
+
+// ToJSONSchema returns a converted copy of an OpenAPI v3 schema the
+// yaml-language-server can validate against, in the spirit of
+// openapi2jsonschema, which built the schemas of the CRD catalog:
+//
+//   - "nullable: true" adds "null" to the allowed types.
+//   - "x-kubernetes-int-or-string" and the "int-or-string" format become an
+//     integer or string choice.
+//   - References to "#/components/schemas/X" point to "#/definitions/X".
+//   - In strict mode, objects with known properties reject unknown fields
+//     unless they preserve them with "x-kubernetes-preserve-unknown-fields".
+func ToJSONSchema(schema map[string]any, strict bool) map[string]any {
+	converted := make(map[string]any, len(schema))
+	for key, value := range schema {
+		converted[key] = value
+	}
+
+	convertSubschemas(converted, strict)
+
+	if ref, ok := converted[keyRef].(string); ok {
+		converted[keyRef] = ComponentRefToDefinition(ref)
+	}
+
+	if nullable, _ := converted[keyNullable].(bool); nullable {
+		if typ, ok := converted["type"].(string); ok {
+			converted["type"] = []any{typ, "null"}
+		}
+	}
+	delete(converted, keyNullable)
+
+	convertIntOrString(converted)
+
+	preserveUnknown, _ := converted[keyPreserveUnknown].(bool)
+	_, hasProperties := converted["properties"]
+	_, hasAdditional := converted[keyAdditionalProperty]
+	if strict && hasProperties && !hasAdditional && !preserveUnknown {
+		converted[keyAdditionalProperty] = false
+	}
+
+	return converted
+}
+
+// ComponentRefToDefinition maps a reference to an OpenAPI component onto the
+// JSON Schema definition of the same name. Other references are returned as is.
+func ComponentRefToDefinition(ref string) string {
+	if name, ok := strings.CutPrefix(ref, componentsPrefix); ok {
+		return definitionsPrefix + name
+	}
+	return ref
+}
+
+// convertIntOrString allows both integers and strings for int-or-string
+// values, which OpenAPI either marks with an extension or a string format.
+func convertIntOrString(schema map[string]any) {
+	intOrString, _ := schema[keyIntOrString].(bool)
+	if format, _ := schema["format"].(string); format == formatIntOrString {
+		intOrString = true
+		delete(schema, "type")
+		delete(schema, "format")
+	}
+	if !intOrString {
+		return
+	}
+
+	if _, hasType := schema["type"]; !hasType && schema["anyOf"] == nil && schema["oneOf"] == nil {
+		schema["anyOf"] = []any{
+			map[string]any{"type": "integer"},
+			map[string]any{"type": "string"},
+		}
+	}
+}
+
+// convertSubschemas converts the nested schemas of schema in place.
+func convertSubschemas(schema map[string]any, strict bool) {
+	if properties, ok := schema["properties"].(map[string]any); ok {
+		convertedProperties := make(map[string]any, len(properties))
+		for name, property := range properties {
+			convertedProperties[name] = convertValue(property, strict)
+		}
+		schema["properties"] = convertedProperties
+	}
+
+	for _, key := range schemaKeywordsWithSubschema {
+		if value, ok := schema[key]; ok {
+			schema[key] = convertValue(value, strict)
+		}
+	}
+
+	for _, key := range schemaKeywordsWithSubschemaList {
+		if list, ok := schema[key].([]any); ok {
+			convertedList := make([]any, 0, len(list))
+			for _, item := range list {
+				convertedList = append(convertedList, convertValue(item, strict))
+			}
+			schema[key] = convertedList
+		}
+	}
+}
+
+// convertValue converts value if it is a schema and returns it unchanged
+// otherwise, e.g. for "additionalProperties: true".
+func convertValue(value any, strict bool) any {
+	if schema, ok := value.(map[string]any); ok {
+		return ToJSONSchema(schema, strict)
+	}
+	return value
+}
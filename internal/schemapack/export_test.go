@@ -0,0 +1,6 @@
+package schemapack
+
+// EntryName and MaxEntrySize expose entryName and maxEntrySize to the tests.
+var EntryName = entryName
+
+const MaxEntrySize = maxEntrySize
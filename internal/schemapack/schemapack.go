@@ -0,0 +1,200 @@
+// Package schemapack reads and writes schema packs: gzip compressed tar
+// archives of schemas laid out like the schema cache, which serve schemas
+// while their sources can't be reached.
+package schemapack
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	_ "embed" // the default pack is embedded into the binary
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+// EmbeddedName is the name of the pack embedded in the binary.
+const EmbeddedName = "embedded"
+
+// maxEntrySize caps the size of a single schema read from a pack.
+const maxEntrySize = 64 << 20
+
+// embeddedPack holds the schemas of the core kinds of
+// config.DefaultK8sSchemaVersion, in the default flavour, and ObjectMeta. It
+// is committed, so every build embeds the same schemas. "go generate"
+// downloads them with the default settings, whatever the developer
+// configured, and has to be run again whenever the default version changes.
+//
+//go:generate go run ../../cmd/yaml-schema-router pack build --defaults --core --output default.tar.gz
+//go:embed default.tar.gz
+var embeddedPack []byte
+
+// Pack is a read-only set of schemas keyed by their slash separated path in
+// the schema cache, e.g. "kubernetes-builtin/v1.33.0-standalone-strict/service-v1.json".
+// The archive is read on first use.
+type Pack struct {
+	Name string
+
+	open func() (io.ReadCloser, error)
+
+	once  sync.Once
+	files map[string][]byte
+	err   error
+}
+
+// Embedded returns the pack embedded in the binary.
+func Embedded() *Pack {
+	return &Pack{
+		Name: EmbeddedName,
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(embeddedPack)), nil
+		},
+	}
+}
+
+// Open returns the pack stored at path.
+func Open(path string) *Pack {
+	return &Pack{
+		Name: path,
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path) //nolint:gosec // packs are configured by the user
+		},
+	}
+}
+
+// Get returns the schema stored under name.
+func (p *Pack) Get(name string) ([]byte, bool, error) {
+	p.once.Do(p.load)
+	if p.err != nil {
+		return nil, false, p.err
+	}
+
+	data, ok := p.files[name]
+	return data, ok, nil
+}
+
+// Names returns the sorted names of the schemas in the pack.
+func (p *Pack) Names() ([]string, error) {
+	p.once.Do(p.load)
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	names := make([]string, 0, len(p.files))
+	for name := range p.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (p *Pack) load() {
+	p.files, p.err = p.read()
+	if p.err != nil {
+		p.err = fmt.Errorf("failed to read schema pack %s: %w", p.Name, p.err)
+	}
+}
+
+func (p *Pack) read() (map[string][]byte, error) {
+	f, err := p.open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name, ok := entryName(header)
+		if !ok {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(archive, maxEntrySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxEntrySize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", name, maxEntrySize)
+		}
+		files[name] = data
+	}
+}
+
+// entryName returns the cleaned name of a regular file entry. Entries that
+// would leave the cache directory are skipped.
+func entryName(header *tar.Header) (string, bool) {
+	if header.Typeflag != tar.TypeReg {
+		return "", false
+	}
+
+	name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+
+	return name, true
+}
+
+// Write stores files, keyed by their slash separated path in the schema
+// cache, as a pack. Entries are sorted and carry no timestamps, so the same
+// schemas always produce the same archive.
+func Write(w io.Writer, files map[string][]byte) error {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gz, err := gzip.NewWriterLevel(w, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewWriter(gz)
+
+	for _, name := range names {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     int64(config.DefaultFilePerm),
+			Size:     int64(len(files[name])),
+			ModTime:  time.Unix(0, 0),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatPAX,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(files[name]); err != nil {
+			return err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
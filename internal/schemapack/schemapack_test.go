@@ -0,0 +1,198 @@
+package schemapack_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/schemapack"
+)
+
+// writePack writes files as a pack into a temporary directory and opens it.
+func writePack(t *testing.T, files map[string][]byte) *schemapack.Pack {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pack.tar.gz")
+	f, err := os.Create(path) //nolint:gosec // the path is in the test's temporary directory
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schemapack.Write(f, files); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return schemapack.Open(path)
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	files := map[string][]byte{
+		"kubernetes-builtin/v1.33.0-standalone-strict/service-v1.json": []byte(`{"type": "object"}`),
+		"kubernetes-crd/example.com/widget_v1.json":                    []byte(`{"type": "string"}`),
+		"empty.json": {},
+	}
+	pack := writePack(t, files)
+
+	names, err := pack.Names()
+	if err != nil {
+		t.Fatalf("Names() error = %v", err)
+	}
+	want := []string{
+		"empty.json",
+		"kubernetes-builtin/v1.33.0-standalone-strict/service-v1.json",
+		"kubernetes-crd/example.com/widget_v1.json",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Names() = %v, want %v", names, want)
+	}
+
+	for name, data := range files {
+		got, ok, err := pack.Get(name)
+		if err != nil || !ok || !bytes.Equal(got, data) {
+			t.Errorf("Get(%q) = %q, %t, %v, want %q", name, got, ok, err, data)
+		}
+	}
+	if _, ok, err := pack.Get("missing.json"); ok || err != nil {
+		t.Errorf("Get() of a missing schema = %t, %v, want not found", ok, err)
+	}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	files := map[string][]byte{"b.json": []byte("{}"), "a.json": []byte("{}"), "c/d.json": []byte("{}")}
+
+	var first, second bytes.Buffer
+	if err := schemapack.Write(&first, files); err != nil {
+		t.Fatal(err)
+	}
+	if err := schemapack.Write(&second, files); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("Write() of the same schemas produced different archives")
+	}
+}
+
+func TestEntryName(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		typeflag byte
+		wantName string
+		wantOK   bool
+	}{
+		{name: "regular file", entry: "a/b.json", typeflag: tar.TypeReg, wantName: "a/b.json", wantOK: true},
+		{name: "dot prefix", entry: "./a/b.json", typeflag: tar.TypeReg, wantName: "a/b.json", wantOK: true},
+		{name: "inner parent", entry: "a/../b.json", typeflag: tar.TypeReg, wantName: "b.json", wantOK: true},
+		{name: "parent", entry: "../b.json", typeflag: tar.TypeReg},
+		{name: "escaping parent", entry: "a/../../b.json", typeflag: tar.TypeReg},
+		{name: "only parent", entry: "..", typeflag: tar.TypeReg},
+		{name: "absolute", entry: "/etc/passwd", typeflag: tar.TypeReg},
+		{name: "current directory", entry: "./", typeflag: tar.TypeReg},
+		{name: "directory", entry: "a/", typeflag: tar.TypeDir},
+		{name: "symlink", entry: "a.json", typeflag: tar.TypeSymlink},
+		{name: "hard link", entry: "a.json", typeflag: tar.TypeLink},
+		{name: "fifo", entry: "a.json", typeflag: tar.TypeFifo},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, ok := schemapack.EntryName(&tar.Header{Name: tt.entry, Typeflag: tt.typeflag})
+			if name != tt.wantName || ok != tt.wantOK {
+				t.Errorf("entryName(%q) = %q, %t, want %q, %t", tt.entry, name, ok, tt.wantName, tt.wantOK)
+			}
+		})
+	}
+}
+
+// rawPack returns a pack of the given size, whose single entry is written
+// without Write.
+func rawPack(t *testing.T, size int64) *schemapack.Pack {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "raw.tar.gz")
+	f, err := os.Create(path) //nolint:gosec // the path is in the test's temporary directory
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewWriterLevel(f, gzip.NoCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := tar.NewWriter(gz)
+
+	header := &tar.Header{Name: "big.json", Size: size, Typeflag: tar.TypeReg, Mode: 0o600}
+	if err := archive.WriteHeader(header); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.CopyN(archive, zeros{}, size); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []io.Closer{archive, gz, f} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return schemapack.Open(path)
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestMaxEntrySize(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		wantErr bool
+	}{
+		{name: "at the limit", size: schemapack.MaxEntrySize},
+		{name: "over the limit", size: schemapack.MaxEntrySize + 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, ok, err := rawPack(t, tt.size).Get("big.json")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Get() of an entry of %d bytes succeeded, want an error", tt.size)
+				}
+				return
+			}
+			if err != nil || !ok || int64(len(data)) != tt.size {
+				t.Errorf("Get() = %d bytes, %t, %v, want %d bytes", len(data), ok, err, tt.size)
+			}
+		})
+	}
+}
+
+func TestCorruptPack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupt.tar.gz")
+	if err := os.WriteFile(path, []byte("not a pack"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pack := schemapack.Open(path)
+	if _, _, err := pack.Get("a.json"); err == nil {
+		t.Error("Get() from a corrupt pack succeeded, want an error")
+	}
+	if _, err := pack.Names(); err == nil {
+		t.Error("Names() of a corrupt pack succeeded, want an error")
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	if _, err := schemapack.Embedded().Names(); err != nil {
+		t.Errorf("Names() of the embedded pack error = %v", err)
+	}
+}
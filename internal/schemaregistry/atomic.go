@@ -0,0 +1,37 @@
+package schemaregistry
+
+import (
+	"os"
+	"path/filepath"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+// writeFileAtomic replaces path with data through a temporary file in the
+// same directory, so readers in this or another process never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(config.DefaultFilePerm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,20 +2,76 @@
 package schemaregistry
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
 
 	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
 )
 
-// download fetches the raw bytes from a given URL with a strict timeout.
-func download(url string) ([]byte, error) {
+// httpStatusError reports a non-2xx response from a schema server.
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status: %d", e.StatusCode)
+}
+
+// validators are the cache validators of a downloaded schema, sent back with
+// conditional requests.
+type validators struct {
+	ETag         string
+	LastModified string
+}
+
+// response is a downloaded schema. NotModified is set, and Data is empty,
+// when the server confirmed the validators of a conditional request.
+type response struct {
+	Data        []byte
+	Validators  validators
+	NotModified bool
+}
+
+// download fetches the raw bytes from a given URL with a strict timeout,
+// reading at most one byte more than the maximum schema size. file:// URLs
+// are read from disk. Non-empty validators make the request conditional.
+func download(ctx context.Context, url string, cfg *config.RegistryConfig, cached validators) (*response, error) {
+	if path, ok := fileuri.ToPath(url); ok {
+		f, err := os.Open(path) //nolint:gosec // file sources are configured by the user
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		data, err := readLimited(f, cfg.MaxSchemaSize)
+		if err != nil {
+			return nil, err
+		}
+		return &response{Data: data}, nil
+	}
+
 	client := &http.Client{
-		Timeout: config.DefaultDownloaderTimeout,
+		Timeout: cfg.DownloadTimeout,
 	}
 
-	resp, err := client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	if cached.ETag != "" {
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+	if cached.LastModified != "" {
+		req.Header.Set("If-Modified-Since", cached.LastModified)
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -23,9 +79,32 @@ func download(url string) ([]byte, error) {
 		_ = resp.Body.Close()
 	}()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return &response{Validators: cached, NotModified: true}, nil
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+		return nil, &httpStatusError{StatusCode: resp.StatusCode}
+	}
+
+	data, err := readLimited(resp.Body, cfg.MaxSchemaSize)
+	if err != nil {
+		return nil, err
 	}
 
-	return io.ReadAll(resp.Body)
+	return &response{
+		Data: data,
+		Validators: validators{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		},
+	}, nil
+}
+
+// readLimited reads r up to one byte past maxSize, enough for validateSchema
+// to reject oversized schemas without buffering them whole.
+func readLimited(r io.Reader, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		return io.ReadAll(r)
+	}
+	return io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
 }
@@ -0,0 +1,17 @@
+package schemaregistry
+
+import "time"
+
+// ValidateSchema checks that data looks like a JSON Schema of a supported draft.
+var ValidateSchema = validateSchema
+
+// StatusError returns the error of a download answered with status.
+func StatusError(status int) error {
+	return &httpStatusError{StatusCode: status}
+}
+
+// RecordFailure records a failed download of url in the negative cache and
+// returns when it is retried.
+func (r *Registry) RecordFailure(url string, cause error) time.Time {
+	return r.negative.record(url, cause)
+}
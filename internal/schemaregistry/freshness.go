@@ -0,0 +1,167 @@
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+)
+
+// metaSuffix is appended to the cache path of a downloaded schema to name the
+// file holding its cacheMeta.
+const metaSuffix = ".meta.json"
+
+// cacheMeta records where and when a cached schema was downloaded.
+type cacheMeta struct {
+	SourceURL    string    `json:"sourceURL"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+
+	// Pack names the schema pack the schema was copied from, until it is
+	// downloaded from its source.
+	Pack string `json:"pack,omitempty"`
+}
+
+func (m cacheMeta) validators() validators {
+	return validators{ETag: m.ETag, LastModified: m.LastModified}
+}
+
+// OnChange registers fn to be called with the cache path of every schema
+// whose content changed when it was revalidated.
+func (r *Registry) OnChange(fn func(cachePath string)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listeners = append(r.listeners, fn)
+}
+
+// readMeta returns the metadata of a cached schema. Schemas cached before
+// metadata was recorded have none.
+func (r *Registry) readMeta(cachePath string) (cacheMeta, bool) {
+	var meta cacheMeta
+
+	data, err := os.ReadFile(r.GetLocalPath(cachePath + metaSuffix))
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		log.Printf("[%s] Ignoring corrupt metadata of %s: %v", componentName, cachePath, err)
+		return meta, false
+	}
+
+	return meta, true
+}
+
+func (r *Registry) writeMeta(cachePath string, meta cacheMeta) {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		log.Printf("[%s] Error marshaling metadata of %s: %v", componentName, cachePath, err)
+		return
+	}
+
+	if err := r.SaveLocalSchema(cachePath+metaSuffix, data); err != nil {
+		log.Printf("[%s] Error saving metadata of %s: %v", componentName, cachePath, err)
+	}
+}
+
+// revalidateIfStale starts a background revalidation of a cached schema
+// older than the configured max age or copied from a schema pack, whatever
+// the max age. The cached copy keeps being served meanwhile, and stays in use
+// if its source can't be reached.
+func (r *Registry) revalidateIfStale(remoteURL, cachePath string) {
+	maxAge := r.config.Registry.MaxAge
+	meta, ok := r.readMeta(cachePath)
+	if meta.Pack == "" && (maxAge <= 0 || ok && time.Since(meta.FetchedAt) < maxAge) {
+		return
+	}
+	if meta.SourceURL == "" {
+		meta.SourceURL = remoteURL
+	}
+
+	// A source that failed recently is not asked again until its backoff expires
+	if _, unavailable := r.negative.lookup(meta.SourceURL); unavailable {
+		return
+	}
+
+	r.mu.Lock()
+	if r.revalidating[cachePath] {
+		r.mu.Unlock()
+		return
+	}
+	r.revalidating[cachePath] = true
+	r.mu.Unlock()
+
+	go func() {
+		defer func() {
+			r.mu.Lock()
+			delete(r.revalidating, cachePath)
+			r.mu.Unlock()
+		}()
+
+		r.revalidate(cachePath, meta)
+	}()
+}
+
+// revalidate asks the source of a cached schema whether it changed, with a
+// conditional request if validators are known, and replaces the cached copy
+// if it did.
+func (r *Registry) revalidate(cachePath string, meta cacheMeta) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.Registry.DownloadTimeout)
+	defer cancel()
+
+	log.Printf("[%s] Revalidating %s with %s", componentName, cachePath, meta.SourceURL)
+
+	resp, err := download(ctx, meta.SourceURL, &r.config.Registry, meta.validators())
+	if err == nil && !resp.NotModified {
+		err = validateSchema(resp.Data, r.config.Registry.MaxSchemaSize)
+	}
+	if err != nil {
+		if _, isFile := fileuri.ToPath(meta.SourceURL); !isFile {
+			r.negative.record(meta.SourceURL, err)
+		}
+		log.Printf("[%s] Keeping stale %s: %v", componentName, cachePath, err)
+		return
+	}
+	r.negative.forget(meta.SourceURL)
+
+	meta.FetchedAt = time.Now()
+	meta.Pack = ""
+	if resp.NotModified {
+		log.Printf("[%s] %s is up to date", componentName, cachePath)
+		r.writeMeta(cachePath, meta)
+		return
+	}
+	meta.ETag, meta.LastModified = resp.Validators.ETag, resp.Validators.LastModified
+
+	current, err := os.ReadFile(r.GetLocalPath(cachePath))
+	if err == nil && bytes.Equal(current, resp.Data) {
+		log.Printf("[%s] %s is unchanged", componentName, cachePath)
+		r.writeMeta(cachePath, meta)
+		return
+	}
+
+	if err := r.SaveLocalSchema(cachePath, resp.Data); err != nil {
+		log.Printf("[%s] Failed to update %s: %v", componentName, cachePath, err)
+		return
+	}
+	r.writeMeta(cachePath, meta)
+
+	log.Printf("[%s] Updated %s from %s", componentName, cachePath, meta.SourceURL)
+	r.notifyChange(cachePath)
+}
+
+func (r *Registry) notifyChange(cachePath string) {
+	r.mu.Lock()
+	listeners := slices.Clone(r.listeners)
+	r.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(cachePath)
+	}
+}
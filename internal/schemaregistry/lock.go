@@ -0,0 +1,135 @@
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+const (
+	// lockSuffix is appended to a cache file to name the lock file held while
+	// it is downloaded.
+	lockSuffix = ".lock"
+
+	// lockPollInterval is how often a held lock is checked again.
+	lockPollInterval = 50 * time.Millisecond
+
+	// lockRefreshInterval is how often a held lock's modification time is
+	// updated, however long the download takes.
+	lockRefreshInterval = 10 * time.Second
+
+	// lockStaleAfter is the age after which a lock is considered abandoned by
+	// a process that died while holding it.
+	lockStaleAfter = 3 * lockRefreshInterval
+)
+
+// acquireLock creates the lock file of path, waiting while another process
+// holds it. The lock is refreshed until the returned function releases it.
+func acquireLock(ctx context.Context, path string) (func(), error) {
+	lockPath := path + lockSuffix
+
+	for {
+		//nolint:gosec // the path lives inside our cache directory
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, config.DefaultFilePerm)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()))
+			_ = f.Close()
+			return refreshLock(lockPath), nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			log.Printf("[%s] Removing stale lock %s", componentName, lockPath)
+			_ = os.Remove(lockPath)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// refreshLock keeps the lock at lockPath from going stale while it is held
+// and returns the function releasing it.
+func refreshLock(lockPath string) func() {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(lockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				_ = os.Chtimes(lockPath, now, now)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-stopped
+		_ = os.Remove(lockPath)
+	}
+}
+
+// flight is a download in progress that concurrent callers wait for.
+type flight struct {
+	done chan struct{}
+	uri  string
+	err  error
+}
+
+// flightGroup coalesces concurrent downloads of the same cache file into one.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do runs fn once for all concurrent callers with the same key. fn runs
+// detached from the caller's cancellation, so a caller giving up does not
+// fail the others; it only stops waiting.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) (string, error)) (string, error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, ok := g.flights[key]
+	if !ok {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+
+		go func() {
+			f.uri, f.err = fn(context.WithoutCancel(ctx))
+
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.uri, f.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
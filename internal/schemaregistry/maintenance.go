@@ -0,0 +1,482 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+)
+
+// touchInterval is how old the modification time of a generated schema gets
+// before serving it from the cache refreshes it. The modification time tells
+// Prune when a generated schema was last used.
+const touchInterval = time.Hour
+
+// Cache directories and file names of the schemas the router builds itself
+// rather than downloads. Generated schemas are told apart by their location.
+const (
+	// CompositeDir holds the composite schemas of multi-document files.
+	CompositeDir = "composite"
+
+	// LocalCRDDir holds the schemas generated from CRD manifests on disk.
+	LocalCRDDir = "local-crd"
+
+	// ClusterDir holds the OpenAPI snapshot of every cluster context, with
+	// the schemas generated from it in the context's ClusterSchemasDir.
+	ClusterDir        = "cluster"
+	ClusterSchemasDir = "schemas"
+
+	// WrapperSuffix ends the names of the wrappers adding ObjectMeta to CRD
+	// schemas.
+	WrapperSuffix = "_wrapper.json"
+)
+
+// CacheEntry is a schema in the cache.
+type CacheEntry struct {
+	// Path is the cache path of the schema, relative to Dir.
+	Path    string
+	Size    int64
+	ModTime time.Time
+
+	// Generated is set for schemas the router built itself, such as CRD
+	// wrappers and composites. They have no source and are rebuilt on demand.
+	Generated bool
+
+	// SourceURL, FetchedAt and Pack are the metadata of downloaded schemas.
+	SourceURL string
+	FetchedAt time.Time
+	Pack      string
+}
+
+// Stale reports whether a downloaded schema is due for revalidation under
+// maxAge. Schemas copied from a pack always are; generated schemas never are.
+func (e CacheEntry) Stale(maxAge time.Duration) bool {
+	if e.Generated {
+		return false
+	}
+	return e.Pack != "" || maxAge > 0 && time.Since(e.FetchedAt) >= maxAge
+}
+
+// UnavailableSchema is a schema URL that is not retried until RetryAt
+// because its last download failed.
+type UnavailableSchema struct {
+	URL      string
+	Reason   string
+	Failures int
+	RetryAt  time.Time
+}
+
+// PruneResult lists what Prune removed.
+type PruneResult struct {
+	// Removed are the cache paths of the removed schemas.
+	Removed []string
+	// Freed is the number of bytes of the removed files.
+	Freed int64
+}
+
+// Dir returns the cache directory.
+func (r *Registry) Dir() string {
+	return r.baseDir
+}
+
+// CachedFileURI returns the file:// URI of a generated schema if it is in the
+// cache, and records that it was used so that Prune keeps it.
+func (r *Registry) CachedFileURI(cachePath string) (string, bool) {
+	fullPath := r.GetLocalPath(cachePath)
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return "", false
+	}
+
+	recordUse(fullPath, info)
+
+	return r.GetLocalFileURI(cachePath), true
+}
+
+// ReadCached reads a generated file, such as a cluster's OpenAPI snapshot,
+// from the cache and records that it was used so that Prune keeps it.
+func (r *Registry) ReadCached(cachePath string) ([]byte, error) {
+	fullPath := r.GetLocalPath(cachePath)
+
+	data, err := os.ReadFile(fullPath) //nolint:gosec // the path lives inside our cache directory
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(fullPath); err == nil {
+		recordUse(fullPath, info)
+	}
+
+	return data, nil
+}
+
+// recordUse refreshes the modification time of a generated file unless it
+// was refreshed within touchInterval.
+func recordUse(fullPath string, info os.FileInfo) {
+	now := time.Now()
+	if now.Sub(info.ModTime()) <= touchInterval {
+		return
+	}
+	if err := os.Chtimes(fullPath, now, now); err != nil {
+		log.Printf("[%s] Failed to record use of %s: %v", componentName, fullPath, err)
+	}
+}
+
+// Entries returns the schemas in the cache sorted by path. Metadata, lock and
+// temporary files are left out.
+func (r *Registry) Entries() ([]CacheEntry, error) {
+	var entries []CacheEntry
+
+	err := filepath.WalkDir(r.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isSchemaFile(d.Name()) || path == r.negative.path {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		cachePath, err := filepath.Rel(r.baseDir, path)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, r.entry(cachePath, info))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return entries, err
+}
+
+// Entry returns the cache entry of a file:// URI the registry returned. The
+// second return value is false for URIs of files outside the cache.
+func (r *Registry) Entry(localURI string) (CacheEntry, bool) {
+	path, ok := fileuri.ToPath(localURI)
+	if !ok {
+		return CacheEntry{}, false
+	}
+
+	cachePath, err := filepath.Rel(r.baseDir, path)
+	if err != nil || !filepath.IsLocal(cachePath) {
+		return CacheEntry{}, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return CacheEntry{}, false
+	}
+
+	return r.entry(cachePath, info), true
+}
+
+// References returns the file:// URIs that the generated schema at localURI
+// references, such as the members of a composite.
+func (r *Registry) References(localURI string) []string {
+	path, ok := fileuri.ToPath(localURI)
+	if !ok {
+		return nil
+	}
+
+	refs := localRefs(path)
+	uris := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		uris = append(uris, fmt.Sprintf("file://%s", ref))
+	}
+	return uris
+}
+
+// entry builds the cache entry of the schema at cachePath. Downloaded schemas
+// without metadata, such as those cached by earlier releases, date from their
+// modification time.
+func (r *Registry) entry(cachePath string, info fs.FileInfo) CacheEntry {
+	entry := CacheEntry{Path: cachePath, Size: info.Size(), ModTime: info.ModTime(), Generated: isGenerated(cachePath)}
+	if entry.Generated {
+		return entry
+	}
+
+	entry.FetchedAt = info.ModTime()
+	if _, err := os.Stat(r.GetLocalPath(cachePath + metaSuffix)); err == nil {
+		meta, _ := r.readMeta(cachePath)
+		entry.SourceURL, entry.FetchedAt, entry.Pack = meta.SourceURL, meta.FetchedAt, meta.Pack
+	}
+	return entry
+}
+
+// isGenerated reports whether the schema at cachePath was built by the
+// router, judging by its location.
+func isGenerated(cachePath string) bool {
+	parts := strings.Split(filepath.ToSlash(cachePath), "/")
+	switch {
+	case parts[0] == CompositeDir, parts[0] == LocalCRDDir:
+		return true
+	case parts[0] == ClusterDir:
+		return len(parts) > 2 && parts[2] == ClusterSchemasDir
+	default:
+		return strings.HasSuffix(cachePath, WrapperSuffix)
+	}
+}
+
+// isSchemaFile reports whether name is a schema rather than a file the
+// registry keeps next to one.
+func isSchemaFile(name string) bool {
+	return strings.HasSuffix(name, ".json") && !strings.HasSuffix(name, metaSuffix) && !isTempFile(name)
+}
+
+// isTempFile reports whether name is a leftover of writeFileAtomic.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp-")
+}
+
+// UnavailableSchemas returns the schema URLs whose retry backoff is active.
+func (r *Registry) UnavailableSchemas() []UnavailableSchema {
+	return r.negative.active()
+}
+
+// Clear removes the cache path prefix from the cache, or the whole cache if
+// prefix is empty. Clearing the whole cache also forgets failed downloads.
+func (r *Registry) Clear(prefix string) error {
+	if prefix == "" {
+		r.negative.clear()
+
+		entries, err := os.ReadDir(r.baseDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := os.RemoveAll(filepath.Join(r.baseDir, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	cleaned := filepath.Clean(prefix)
+	if !filepath.IsLocal(cleaned) {
+		return fmt.Errorf("%s is not a path inside the cache", prefix)
+	}
+
+	fullPath := r.GetLocalPath(cleaned)
+	if _, err := os.Lstat(fullPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%s is not in the cache", prefix)
+		}
+		return err
+	}
+	if err := os.RemoveAll(fullPath); err != nil {
+		return err
+	}
+	_ = os.Remove(fullPath + metaSuffix)
+
+	return nil
+}
+
+// Prune removes generated schemas that were not used within olderThan or
+// that reference schemas missing from the cache, unless a schema that is
+// kept references them. Downloaded schemas are kept. Prune also removes
+// abandoned lock and temporary files, metadata of missing schemas and
+// expired failed downloads.
+func (r *Registry) Prune(olderThan time.Duration) (PruneResult, error) {
+	var result PruneResult
+
+	entries, err := r.Entries()
+	if err != nil {
+		return result, err
+	}
+
+	remove := r.pruneCandidates(entries, time.Now().Add(-olderThan))
+
+	for _, entry := range entries {
+		fullPath := r.GetLocalPath(entry.Path)
+		if !remove[fullPath] {
+			continue
+		}
+		if err := os.Remove(fullPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return result, err
+		}
+		result.Removed = append(result.Removed, entry.Path)
+		result.Freed += entry.Size
+	}
+
+	freed, err := r.removeLeftovers()
+	result.Freed += freed
+	r.negative.pruneExpired()
+
+	return result, err
+}
+
+// pruneCandidates returns the local paths of the generated schemas among
+// entries that Prune removes: those last used before cutoff that no kept
+// schema references, and the broken ones.
+func (r *Registry) pruneCandidates(entries []CacheEntry, cutoff time.Time) map[string]bool {
+	exists := make(map[string]bool, len(entries))
+	refs := make(map[string][]string)
+	for _, entry := range entries {
+		fullPath := r.GetLocalPath(entry.Path)
+		exists[fullPath] = true
+		if entry.Generated {
+			refs[fullPath] = localRefs(fullPath)
+		}
+	}
+
+	broken := brokenSchemas(refs, exists)
+	remove := make(map[string]bool)
+	for _, entry := range entries {
+		fullPath := r.GetLocalPath(entry.Path)
+		if entry.Generated && (entry.ModTime.Before(cutoff) || broken[fullPath]) {
+			remove[fullPath] = true
+		}
+	}
+	keepReferenced(refs, remove, broken)
+
+	return remove
+}
+
+// brokenSchemas returns the generated schemas that reference a missing file
+// or another broken schema. Files outside the cache, such as local CRDs,
+// count as present if they exist.
+func brokenSchemas(refs map[string][]string, exists map[string]bool) map[string]bool {
+	broken := make(map[string]bool)
+	for path, pathRefs := range refs {
+		for _, ref := range pathRefs {
+			if exists[ref] {
+				continue
+			}
+			if _, err := os.Stat(ref); err != nil {
+				broken[path] = true
+				break
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for path, pathRefs := range refs {
+			if broken[path] {
+				continue
+			}
+			for _, ref := range pathRefs {
+				if broken[ref] {
+					broken[path] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	return broken
+}
+
+// keepReferenced takes schemas off remove that a kept schema references,
+// directly or through other kept schemas. Broken schemas are removed
+// regardless, as they can't be used anyway.
+func keepReferenced(refs map[string][]string, remove, broken map[string]bool) {
+	for changed := true; changed; {
+		changed = false
+		for path, pathRefs := range refs {
+			if remove[path] {
+				continue
+			}
+			for _, ref := range pathRefs {
+				if remove[ref] && !broken[ref] {
+					delete(remove, ref)
+					changed = true
+				}
+			}
+		}
+	}
+}
+
+// removeLeftovers removes abandoned lock and temporary files and the
+// metadata of schemas that are gone, returning the bytes freed.
+func (r *Registry) removeLeftovers() (int64, error) {
+	var freed int64
+
+	err := filepath.WalkDir(r.baseDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var leftover bool
+		switch name := d.Name(); {
+		case strings.HasSuffix(name, lockSuffix), isTempFile(name):
+			leftover = time.Since(info.ModTime()) > lockStaleAfter
+		case strings.HasSuffix(name, metaSuffix):
+			_, statErr := os.Stat(strings.TrimSuffix(path, metaSuffix))
+			leftover = errors.Is(statErr, fs.ErrNotExist)
+		}
+		if !leftover {
+			return nil
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		freed += info.Size()
+		return nil
+	})
+
+	return freed, err
+}
+
+// localRefs returns the local paths of the file:// "$ref"s of the schema at
+// path, without fragments.
+func localRefs(path string) []string {
+	data, err := os.ReadFile(path) //nolint:gosec // the path lives inside our cache directory
+	if err != nil {
+		return nil
+	}
+
+	var document any
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil
+	}
+
+	var refs []string
+	collectRefs(document, func(ref string) {
+		ref, _, _ = strings.Cut(ref, "#")
+		if local, ok := fileuri.ToPath(ref); ok && local != "" {
+			refs = append(refs, local)
+		}
+	})
+
+	sort.Strings(refs)
+	return refs
+}
+
+// collectRefs calls fn with every "$ref" string in node.
+func collectRefs(node any, fn func(string)) {
+	switch n := node.(type) {
+	case map[string]any:
+		for key, value := range n {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				fn(ref)
+				continue
+			}
+			collectRefs(value, fn)
+		}
+	case []any:
+		for _, value := range n {
+			collectRefs(value, fn)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package schemaregistry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+)
+
+const (
+	// negativeCacheFileName is the file inside the cache directory that
+	// persists failed downloads across sessions.
+	negativeCacheFileName = "negative-cache.json"
+
+	// negativeCacheLockTimeout is how long an update waits for another
+	// router instance to finish writing the file.
+	negativeCacheLockTimeout = 5 * time.Second
+)
+
+// ErrSchemaUnavailable is returned for schemas whose last download failed and
+// whose retry backoff has not expired yet.
+var ErrSchemaUnavailable = errors.New("schema unavailable")
+
+// retryError is a failed download that is not retried before retryAt.
+// notFound is set if the source said that the schema does not exist.
+type retryError struct {
+	err      error
+	retryAt  time.Time
+	notFound bool
+}
+
+func (e *retryError) Error() string { return e.err.Error() }
+func (e *retryError) Unwrap() error { return e.err }
+
+// RetryAt returns when the registry retries the download that failed with
+// err, the earliest one if err holds several. It returns false for errors
+// that are retried right away, such as those of file:// sources.
+func RetryAt(err error) (time.Time, bool) {
+	var retryAt time.Time
+	found := false
+
+	// errors.As only finds the first one, so the tree is walked by hand
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case *retryError:
+			if !found || e.retryAt.Before(retryAt) {
+				retryAt, found = e.retryAt, true
+			}
+		case interface{ Unwrap() []error }:
+			for _, inner := range e.Unwrap() {
+				walk(inner)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+
+	return retryAt, found
+}
+
+// negativeEntry records why and until when a remote schema is not retried.
+type negativeEntry struct {
+	Reason   string    `json:"reason"`
+	Failures int       `json:"failures"`
+	RetryAt  time.Time `json:"retryAt"`
+	NotFound bool      `json:"notFound,omitempty"`
+}
+
+// negativeCache remembers remote URLs that recently failed to download, so a
+// missing schema costs one request per backoff period instead of one per edit.
+type negativeCache struct {
+	path   string
+	config *config.RegistryConfig
+
+	// mu guards entries, the in-memory copy of the file.
+	mu      sync.Mutex
+	entries map[string]negativeEntry
+}
+
+// loadNegativeCache reads the persisted entries. A missing or corrupt file
+// starts an empty cache.
+func loadNegativeCache(path string, cfg *config.RegistryConfig) *negativeCache {
+	c := &negativeCache{
+		path:    path,
+		config:  cfg,
+		entries: make(map[string]negativeEntry),
+	}
+
+	if entries, ok := c.read(); ok {
+		c.entries = entries
+	}
+	return c
+}
+
+// read returns the persisted entries. A missing file has none; a corrupt one
+// is reported as unreadable.
+func (c *negativeCache) read() (map[string]negativeEntry, bool) {
+	entries := make(map[string]negativeEntry)
+
+	data, err := os.ReadFile(c.path) //nolint:gosec // the path lives inside our cache directory
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, true
+	}
+	if err != nil {
+		return nil, false
+	}
+
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("[%s] Ignoring corrupt negative cache %s: %v", componentName, c.path, err)
+		return nil, false
+	}
+	return entries, true
+}
+
+// update applies change to the entries and persists them. Router instances
+// share the file, so it is re-read under its lock and change is applied to
+// what the others wrote in the meantime. The file lock, which also orders
+// updates within this process, is waited for and the file read and written
+// without holding c.mu, which only guards swapping in the result.
+func (c *negativeCache) update(change func(entries map[string]negativeEntry)) {
+	ctx, cancel := context.WithTimeout(context.Background(), negativeCacheLockTimeout)
+	defer cancel()
+
+	unlock, err := acquireLock(ctx, c.path)
+	if err != nil {
+		log.Printf("[%s] Failed to lock negative cache %s: %v", componentName, c.path, err)
+		c.mu.Lock()
+		change(c.entries)
+		c.mu.Unlock()
+		return
+	}
+	defer unlock()
+
+	entries, ok := c.read()
+	if !ok {
+		c.mu.Lock()
+		entries = maps.Clone(c.entries)
+		c.mu.Unlock()
+	}
+	change(entries)
+	c.save(entries)
+
+	c.mu.Lock()
+	c.entries = entries
+	c.mu.Unlock()
+}
+
+// lookup returns the entry for url if its backoff is still active.
+func (c *negativeCache) lookup(url string) (negativeEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[url]
+	if !ok || time.Now().After(entry.RetryAt) {
+		return negativeEntry{}, false
+	}
+
+	return entry, true
+}
+
+// record registers a failed download. Missing schemas back off from
+// NotFoundBackoff, other failures from RetryBackoff; each consecutive failure
+// doubles the delay up to MaxRetryBackoff. It returns when url is retried.
+func (c *negativeCache) record(url string, cause error) time.Time {
+	var retryAt time.Time
+	c.update(func(entries map[string]negativeEntry) {
+		entry := entries[url]
+		entry.Failures++
+		entry.Reason = cause.Error()
+		entry.NotFound = isNotFound(cause)
+
+		backoff := c.config.RetryBackoff
+		if entry.NotFound {
+			backoff = c.config.NotFoundBackoff
+		}
+		for i := 1; i < entry.Failures && backoff < c.config.MaxRetryBackoff; i++ {
+			backoff *= 2
+		}
+		backoff = min(backoff, c.config.MaxRetryBackoff)
+
+		entry.RetryAt = time.Now().Add(backoff)
+		entries[url] = entry
+		retryAt = entry.RetryAt
+
+		log.Printf("[%s] Not retrying %s for %s: %s", componentName, url, backoff, entry.Reason)
+	})
+
+	return retryAt
+}
+
+// forget clears url after a successful download.
+func (c *negativeCache) forget(url string) {
+	c.mu.Lock()
+	_, ok := c.entries[url]
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	c.update(func(entries map[string]negativeEntry) {
+		delete(entries, url)
+	})
+}
+
+// active returns the entries whose backoff is still active, sorted by URL.
+func (c *negativeCache) active() []UnavailableSchema {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	schemas := make([]UnavailableSchema, 0, len(c.entries))
+	for url, entry := range c.entries {
+		if now.After(entry.RetryAt) {
+			continue
+		}
+		schemas = append(schemas, UnavailableSchema{
+			URL: url, Reason: entry.Reason, Failures: entry.Failures, RetryAt: entry.RetryAt,
+		})
+	}
+
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].URL < schemas[j].URL })
+	return schemas
+}
+
+// pruneExpired drops the entries whose backoff expired.
+func (c *negativeCache) pruneExpired() {
+	c.update(func(entries map[string]negativeEntry) {
+		now := time.Now()
+		for url, entry := range entries {
+			if now.After(entry.RetryAt) {
+				delete(entries, url)
+			}
+		}
+	})
+}
+
+// clear drops all entries, so every schema is retried.
+func (c *negativeCache) clear() {
+	c.update(func(entries map[string]negativeEntry) {
+		for url := range entries {
+			delete(entries, url)
+		}
+	})
+}
+
+// save persists entries. Callers must hold the file lock.
+func (c *negativeCache) save(entries map[string]negativeEntry) {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		log.Printf("[%s] Error marshaling negative cache: %v", componentName, err)
+		return
+	}
+
+	if err := writeFileAtomic(c.path, data); err != nil {
+		log.Printf("[%s] Error saving negative cache: %v", componentName, err)
+	}
+}
+
+// IsNotFound reports whether err says that a schema does not exist, as
+// opposed to that it could not be fetched, also while its download is backing
+// off. Errors of several sources must all say so.
+func IsNotFound(err error) bool {
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *retryError:
+		return e.notFound || IsNotFound(e.err)
+	case *httpStatusError:
+		return isNotFound(e)
+	case interface{ Unwrap() []error }:
+		errs := e.Unwrap()
+		for _, inner := range errs {
+			if !IsNotFound(inner) {
+				return false
+			}
+		}
+		return len(errs) > 0
+	case interface{ Unwrap() error }:
+		return IsNotFound(e.Unwrap())
+	default:
+		// Missing files of file:// sources
+		return errors.Is(err, fs.ErrNotExist)
+	}
+}
+
+// isNotFound reports whether err is an HTTP response saying the schema does not exist.
+func isNotFound(err error) bool {
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	return statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone
+}
@@ -0,0 +1,218 @@
+package schemaregistry_test
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const schemaURL = "https://schemas.example.com/widget.json"
+
+// backoffConfig returns a configuration with distinguishable backoffs.
+func backoffConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Registry.RetryBackoff = time.Minute
+	cfg.Registry.NotFoundBackoff = time.Hour
+	cfg.Registry.MaxRetryBackoff = 6 * time.Hour
+	return cfg
+}
+
+func TestNegativeCacheBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		cause    error
+		failures int
+		want     time.Duration
+	}{
+		{name: "first failure", cause: errors.New("connection refused"), failures: 1, want: time.Minute},
+		{name: "server error", cause: schemaregistry.StatusError(http.StatusBadGateway), failures: 1, want: time.Minute},
+		{name: "doubles", cause: errors.New("connection refused"), failures: 3, want: 4 * time.Minute},
+		{name: "not found", cause: schemaregistry.StatusError(http.StatusNotFound), failures: 1, want: time.Hour},
+		{name: "gone", cause: schemaregistry.StatusError(http.StatusGone), failures: 1, want: time.Hour},
+		{name: "not found doubles", cause: schemaregistry.StatusError(http.StatusNotFound), failures: 2, want: 2 * time.Hour},
+		{name: "capped", cause: schemaregistry.StatusError(http.StatusNotFound), failures: 5, want: 6 * time.Hour},
+		{name: "capped after many failures", cause: errors.New("timeout"), failures: 100, want: 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestRegistry(t, backoffConfig())
+
+			var retryAt time.Time
+			before := time.Now()
+			for range tt.failures {
+				before = time.Now()
+				retryAt = registry.RecordFailure(schemaURL, tt.cause)
+			}
+			after := time.Now()
+
+			if retryAt.Before(before.Add(tt.want)) || retryAt.After(after.Add(tt.want)) {
+				t.Errorf("retry after %s, want %s", retryAt.Sub(before), tt.want)
+			}
+
+			unavailable := registry.UnavailableSchemas()
+			if len(unavailable) != 1 {
+				t.Fatalf("UnavailableSchemas() = %v, want one schema", unavailable)
+			}
+			if got := unavailable[0]; got.URL != schemaURL || got.Failures != tt.failures || !got.RetryAt.Equal(retryAt) {
+				t.Errorf("UnavailableSchemas() = %+v, want %d failures until %s", got, tt.failures, retryAt)
+			}
+		})
+	}
+}
+
+func TestNegativeCacheSkipsDownloads(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	registry := newTestRegistry(t, backoffConfig())
+	url := server.URL + "/widget.json"
+
+	_, err := registry.GetSchemaURI(t.Context(), url, "test/widget.json")
+	if err == nil {
+		t.Fatal("GetSchemaURI() of a missing schema succeeded, want an error")
+	}
+	retryAt, ok := schemaregistry.RetryAt(err)
+	if !ok || time.Until(retryAt) <= 59*time.Minute {
+		t.Errorf("RetryAt() = %s, %t, want the not found backoff", retryAt, ok)
+	}
+
+	// Within the backoff the server is not asked again
+	_, err = registry.GetSchemaURI(t.Context(), url, "test/widget.json")
+	if !errors.Is(err, schemaregistry.ErrSchemaUnavailable) {
+		t.Errorf("GetSchemaURI() during backoff error = %v, want %v", err, schemaregistry.ErrSchemaUnavailable)
+	}
+	if got, ok := schemaregistry.RetryAt(fmt.Errorf("wrapped: %w", err)); !ok || !got.Equal(retryAt) {
+		t.Errorf("RetryAt() during backoff = %s, %t, want %s", got, ok, retryAt)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server asked %d times, want 1", got)
+	}
+
+	// Another router instance sharing the cache skips it as well
+	other, err := schemaregistry.NewRegistry(backoffConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.GetSchemaURI(t.Context(), url, "test/widget.json"); err == nil {
+		t.Error("GetSchemaURI() in another instance succeeded, want an error")
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("server asked %d times across instances, want 1", got)
+	}
+
+	// Clearing the cache forgets the failure
+	if err := registry.Clear(""); err != nil {
+		t.Fatal(err)
+	}
+	if got := registry.UnavailableSchemas(); len(got) != 0 {
+		t.Errorf("UnavailableSchemas() after Clear() = %v, want none", got)
+	}
+}
+
+func TestNegativeCacheConcurrentFailures(t *testing.T) {
+	registry := newTestRegistry(t, backoffConfig())
+
+	const failures = 20
+	var wg sync.WaitGroup
+	for i := range failures {
+		wg.Go(func() {
+			registry.RecordFailure(fmt.Sprintf("%s?v=%d", schemaURL, i), errors.New("connection refused"))
+		})
+	}
+	wg.Wait()
+
+	if got := registry.UnavailableSchemas(); len(got) != failures {
+		t.Errorf("UnavailableSchemas() has %d schemas, want %d", len(got), failures)
+	}
+
+	// Every failure was persisted, none overwritten by a concurrent one
+	other, err := schemaregistry.NewRegistry(backoffConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := other.UnavailableSchemas(); len(got) != failures {
+		t.Errorf("UnavailableSchemas() in another instance has %d schemas, want %d", len(got), failures)
+	}
+}
+
+func TestRetryAtJoinedErrors(t *testing.T) {
+	registry := newTestRegistry(t, backoffConfig())
+	registry.RecordFailure(schemaURL, schemaregistry.StatusError(http.StatusNotFound))
+	registry.RecordFailure(schemaURL+"?v=2", errors.New("connection refused"))
+
+	_, notFound := registry.GetSchemaURI(t.Context(), schemaURL, "test/a.json")
+	_, refused := registry.GetSchemaURI(t.Context(), schemaURL+"?v=2", "test/b.json")
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "nil", err: nil},
+		{name: "other error", err: errors.New("boom")},
+		{name: "single", err: notFound, want: notFound},
+		{name: "joined picks the earliest", err: errors.Join(notFound, errors.New("boom"), refused), want: refused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := schemaregistry.RetryAt(tt.err)
+			if tt.want == nil {
+				if ok {
+					t.Errorf("RetryAt() = %s, want none", got)
+				}
+				return
+			}
+			want, _ := schemaregistry.RetryAt(tt.want)
+			if !ok || !got.Equal(want) {
+				t.Errorf("RetryAt() = %s, %t, want %s", got, ok, want)
+			}
+		})
+	}
+}
+
+func TestIsNotFound(t *testing.T) {
+	registry := newTestRegistry(t, backoffConfig())
+	registry.RecordFailure(schemaURL, schemaregistry.StatusError(http.StatusNotFound))
+	_, backedOff := registry.GetSchemaURI(t.Context(), schemaURL, "test/a.json")
+
+	notFound := schemaregistry.StatusError(http.StatusNotFound)
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil},
+		{name: "other error", err: errors.New("connection refused")},
+		{name: "server error", err: schemaregistry.StatusError(http.StatusBadGateway)},
+		{name: "not found", err: notFound, want: true},
+		{name: "gone", err: schemaregistry.StatusError(http.StatusGone), want: true},
+		{name: "missing file", err: fmt.Errorf("open: %w", fs.ErrNotExist), want: true},
+		{name: "not found during backoff", err: backedOff, want: true},
+		{name: "wrapped", err: fmt.Errorf("fetching: %w", notFound), want: true},
+		{name: "all joined not found", err: errors.Join(notFound, fs.ErrNotExist), want: true},
+		{name: "joined with another error", err: errors.Join(notFound, errors.New("timeout"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schemaregistry.IsNotFound(tt.err); got != tt.want {
+				t.Errorf("IsNotFound(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package schemaregistry
+
+import (
+	"log"
+	"path/filepath"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/schemapack"
+)
+
+// schemaPacks returns the configured schema packs followed by the embedded
+// one. Relative paths are resolved against the workspace root. Packs are
+// read once and kept for the lifetime of the registry.
+func (r *Registry) schemaPacks() []*schemapack.Pack {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	packs := make([]*schemapack.Pack, 0, len(r.config.Registry.Packs)+1)
+	for _, path := range r.config.Registry.Packs {
+		if !filepath.IsAbs(path) && r.config.WorkspaceRoot != "" {
+			path = filepath.Join(r.config.WorkspaceRoot, path)
+		}
+
+		pack, ok := r.packs[path]
+		if !ok {
+			pack = schemapack.Open(path)
+			r.packs[path] = pack
+		}
+		packs = append(packs, pack)
+	}
+
+	return append(packs, r.embedded)
+}
+
+// fromPack copies the schema at cachePath out of the first pack holding it
+// into the cache. Its metadata names the pack, so every lookup of the schema
+// revalidates it with sourceURL, regardless of the max age, until that can
+// be reached.
+func (r *Registry) fromPack(cachePath, sourceURL string) (string, bool) {
+	name := filepath.ToSlash(cachePath)
+
+	for _, pack := range r.schemaPacks() {
+		data, ok, err := pack.Get(name)
+		if err != nil {
+			log.Printf("[%s] %v", componentName, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if err := validateSchema(data, r.config.Registry.MaxSchemaSize); err != nil {
+			log.Printf("[%s] Ignoring %s in schema pack %s: %v", componentName, name, pack.Name, err)
+			continue
+		}
+
+		if err := r.SaveLocalSchema(cachePath, data); err != nil {
+			log.Printf("[%s] Failed to save %s from schema pack %s: %v", componentName, cachePath, pack.Name, err)
+			return "", false
+		}
+		r.writeMeta(cachePath, cacheMeta{SourceURL: sourceURL, FetchedAt: time.Time{}, Pack: pack.Name})
+
+		log.Printf("[%s] Serving %s from schema pack %s", componentName, cachePath, pack.Name)
+		return r.GetLocalFileURI(cachePath), true
+	}
+
+	return "", false
+}
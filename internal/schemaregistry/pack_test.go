@@ -0,0 +1,80 @@
+package schemaregistry_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/schemapack"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+func TestPackSchemaRevalidated(t *testing.T) {
+	var online atomic.Bool
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		if !online.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"type": "string"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	packPath := filepath.Join(t.TempDir(), "pack.tar.gz")
+	f, err := os.Create(packPath) //nolint:gosec // the path is in the test's temporary directory
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := schemapack.Write(f, map[string][]byte{"test/widget.json": []byte(`{"type": "object"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := backoffConfig()
+	cfg.Registry.RetryBackoff = time.Nanosecond
+	cfg.Registry.MaxAge = 0
+	cfg.Registry.Packs = []string{packPath}
+	registry := newTestRegistry(t, cfg)
+
+	changed := make(chan string, 1)
+	registry.OnChange(func(cachePath string) { changed <- cachePath })
+
+	catalog := schemaregistry.Catalog{Name: "test", Layout: "widget.json", Sources: []string{server.URL}}
+	uri, err := registry.Lookup(t.Context(), catalog, schemaregistry.SchemaRef{})
+	if err != nil {
+		t.Fatalf("Lookup() while offline error = %v, want the pack's schema", err)
+	}
+	if entry, ok := registry.Entry(uri); !ok || entry.Pack == "" || !entry.Stale(0) {
+		t.Fatalf("Entry() = %+v, %t, want a stale schema from the pack", entry, ok)
+	}
+
+	// Even without a max age, the next lookup asks the source again
+	online.Store(true)
+	if _, err := registry.Lookup(t.Context(), catalog, schemaregistry.SchemaRef{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the schema from the pack was not revalidated")
+	}
+
+	if entry, ok := registry.Entry(uri); !ok || entry.Pack != "" || entry.Stale(0) {
+		t.Errorf("Entry() after revalidation = %+v, %t, want a downloaded schema", entry, ok)
+	}
+	before := requests.Load()
+	if _, err := registry.Lookup(t.Context(), catalog, schemaregistry.SchemaRef{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != before {
+		t.Errorf("downloaded schema revalidated again without a max age (%d requests, want %d)", got, before)
+	}
+}
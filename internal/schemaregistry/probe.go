@@ -0,0 +1,73 @@
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+)
+
+// SourceProbe is the outcome of fetching a schema from one source of a
+// catalog.
+type SourceProbe struct {
+	Source string
+	URL    string
+
+	Duration time.Duration
+
+	// Err is nil if the source served a valid schema.
+	Err error
+
+	// Missing is set if the source could be reached but does not have the
+	// schema, which is expected of catalogs serving only some schemas.
+	Missing bool
+}
+
+// ProbeCatalog fetches the schema ref points to from every source of the
+// catalog. Neither the cache nor the negative cache is consulted or updated,
+// so the result reflects the sources as they are right now.
+func ProbeCatalog(ctx context.Context, cfg *config.RegistryConfig, catalog Catalog, ref SchemaRef) []SourceProbe {
+	urls := catalog.urls(ref)
+	probes := make([]SourceProbe, 0, len(urls))
+
+	for i, remoteURL := range urls {
+		probe := SourceProbe{Source: catalog.Sources[i], URL: remoteURL}
+
+		start := time.Now()
+		resp, err := download(ctx, remoteURL, cfg, validators{})
+		probe.Duration = time.Since(start)
+
+		if err != nil {
+			probe.Err = err
+			probe.Missing = isNotFound(err) || (errors.Is(err, fs.ErrNotExist) && sourceDirExists(probe.Source))
+		} else {
+			probe.Err = validateSchema(resp.Data, cfg.MaxSchemaSize)
+		}
+
+		probes = append(probes, probe)
+	}
+
+	return probes
+}
+
+// sourceDirExists reports whether the directory of a file:// source exists,
+// telling a missing schema apart from a misconfigured source.
+func sourceDirExists(source string) bool {
+	// The directory of a template is the part before its first placeholder
+	if i := strings.Index(source, "{"); i >= 0 {
+		source = source[:strings.LastIndex(source[:i], "/")+1]
+	}
+
+	path, ok := fileuri.ToPath(source)
+	if !ok {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
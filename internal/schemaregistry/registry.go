@@ -1,6 +1,7 @@
 package schemaregistry
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
@@ -9,62 +10,172 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemapack"
 )
 
 const componentName = "Registry"
 
 // Registry manages a persistent disk cache for JSON schemas.
 type Registry struct {
-	baseDir string
+	baseDir  string
+	config   *config.Config
+	negative *negativeCache
+
+	// flights coalesces concurrent downloads of the same URL.
+	flights flightGroup
+
+	mu sync.Mutex
+	// revalidating holds the cache paths being revalidated in the background.
+	revalidating map[string]bool
+	listeners    []func(cachePath string)
+
+	// packs are the configured schema packs by path; embedded is the one
+	// built into the binary. Both serve schemas that can't be downloaded.
+	packs    map[string]*schemapack.Pack
+	embedded *schemapack.Pack
 }
 
+// compositeSchemaDraft is the JSON Schema draft of generated composites;
+// draft-07 is the first with if/then.
+const compositeSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
 type compositeSchema struct {
-	AnyOf []map[string]string `json:"anyOf"`
+	Schema string           `json:"$schema"`
+	AllOf  []map[string]any `json:"allOf"`
 }
 
-// NewRegistry initializes the user's cache directory.
-func NewRegistry() (*Registry, error) {
+// CacheDir returns the directory schemas are cached in.
+func CacheDir() (string, error) {
 	userCache, err := os.UserCacheDir()
 	if err != nil {
-		return nil, fmt.Errorf("could not determine user cache dir: %w", err)
+		return "", fmt.Errorf("could not determine user cache dir: %w", err)
+	}
+
+	return filepath.Join(userCache, config.DefaultConfigDirName, "schemas"), nil
+}
+
+// NewRegistry initializes the user's cache directory.
+func NewRegistry(cfg *config.Config) (*Registry, error) {
+	baseDir, err := CacheDir()
+	if err != nil {
+		return nil, err
 	}
 
-	baseDir := filepath.Join(userCache, config.DefaultConfigDirName, "schemas")
+	return NewRegistryIn(cfg, baseDir)
+}
+
+// NewRegistryIn initializes a registry caching schemas in baseDir instead of
+// the user's cache directory.
+func NewRegistryIn(cfg *config.Config, baseDir string) (*Registry, error) {
 	if err := os.MkdirAll(baseDir, config.DefaultDirPerm); err != nil {
 		return nil, fmt.Errorf("could not create cache dir: %w", err)
 	}
 
-	return &Registry{baseDir: baseDir}, nil
+	return &Registry{
+		baseDir:  baseDir,
+		config:   cfg,
+		negative: loadNegativeCache(filepath.Join(baseDir, negativeCacheFileName), &cfg.Registry),
+		embedded: schemapack.Embedded(),
+
+		revalidating: make(map[string]bool),
+		packs:        make(map[string]*schemapack.Pack),
+	}, nil
 }
 
 // GetSchemaURI checks if the schema exists on disk. If not, it attempts to
 // download it. Returns a file:// URI on success, or an error if it fails.
-func (r *Registry) GetSchemaURI(remoteURL, cachePath string) (string, error) {
+// Cached schemas older than the configured max age or copied from a schema
+// pack are revalidated in the background while the cached copy is returned.
+func (r *Registry) GetSchemaURI(ctx context.Context, remoteURL, cachePath string) (string, error) {
 	fullPath := filepath.Join(r.baseDir, cachePath)
 
 	// Fast path: check if file already exists in cache
 	if _, err := os.Stat(fullPath); err == nil {
 		log.Printf("[%s] Cache hit: %s", componentName, cachePath)
+		r.revalidateIfStale(remoteURL, cachePath)
 		return fmt.Sprintf("file://%s", fullPath), nil
 	}
 
+	// Files are cheap to look at, so only remote sources back off
+	_, isFile := fileuri.ToPath(remoteURL)
+
+	// Known-missing schema: don't hit the network again until the backoff expires
+	if entry, ok := r.negative.lookup(remoteURL); ok && !isFile {
+		err := fmt.Errorf("%w: %s (%s, retrying after %s)",
+			ErrSchemaUnavailable, remoteURL, entry.Reason, entry.RetryAt.Format(time.RFC3339))
+		return "", &retryError{err: err, retryAt: entry.RetryAt, notFound: entry.NotFound}
+	}
+
 	log.Printf("[%s] Cache miss: %s. Downloading from %s ...", componentName, cachePath, remoteURL)
 
+	return r.flights.do(ctx, remoteURL, func(ctx context.Context) (string, error) {
+		return r.downloadSchema(ctx, remoteURL, cachePath)
+	})
+}
+
+// downloadSchema downloads a schema into the cache while holding its lock
+// file, so router instances sharing the cache download it only once.
+func (r *Registry) downloadSchema(ctx context.Context, remoteURL, cachePath string) (string, error) {
+	fullPath := filepath.Join(r.baseDir, cachePath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), config.DefaultDirPerm); err != nil {
+		return "", err
+	}
+
+	unlock, err := acquireLock(ctx, fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to lock %s: %w", cachePath, err)
+	}
+	defer unlock()
+
+	// Another router instance may have downloaded it while we waited
+	if _, err := os.Stat(fullPath); err == nil {
+		log.Printf("[%s] Downloaded concurrently: %s", componentName, cachePath)
+		return fmt.Sprintf("file://%s", fullPath), nil
+	}
+
+	_, isFile := fileuri.ToPath(remoteURL)
+
 	// Cache miss: download the schema
-	data, err := download(remoteURL)
+	resp, err := download(ctx, remoteURL, &r.config.Registry, validators{})
 	if err != nil {
+		// A canceled detection says nothing about the schema's availability
+		if ctx.Err() == nil && !isFile {
+			retryAt := r.negative.record(remoteURL, err)
+			return "", &retryError{err: fmt.Errorf("failed to download %s: %w", remoteURL, err), retryAt: retryAt}
+		}
 		// Return the error instead of falling back blindly
 		return "", fmt.Errorf("failed to download %s: %w", remoteURL, err)
 	}
 
+	// Error pages and truncated responses must not end up in the cache
+	if err := validateSchema(resp.Data, r.config.Registry.MaxSchemaSize); err != nil {
+		log.Printf("[%s] Rejected download of %s: %v", componentName, remoteURL, err)
+		if !isFile {
+			retryAt := r.negative.record(remoteURL, err)
+			return "", &retryError{err: fmt.Errorf("failed to download %s: %w", remoteURL, err), retryAt: retryAt}
+		}
+		return "", fmt.Errorf("failed to download %s: %w", remoteURL, err)
+	}
+	r.negative.forget(remoteURL)
+
 	log.Printf("[%s] Download successful. Saving to %s", componentName, fullPath)
 
 	// Save to cache
-	if err := r.SaveLocalSchema(cachePath, data); err != nil {
+	if err := r.SaveLocalSchema(cachePath, resp.Data); err != nil {
 		return "", fmt.Errorf("failed to save %s: %w", fullPath, err)
 	}
+	r.writeMeta(cachePath, cacheMeta{
+		SourceURL:    remoteURL,
+		FetchedAt:    time.Now(),
+		ETag:         resp.Validators.ETag,
+		LastModified: resp.Validators.LastModified,
+	})
 
 	return fmt.Sprintf("file://%s", fullPath), nil
 }
@@ -75,6 +186,8 @@ func (r *Registry) GetLocalPath(cachePath string) string {
 }
 
 // SaveLocalSchema writes raw byte data directly to the cache. Useful for generated wrappers.
+// The file is replaced atomically, so concurrent readers see either the old
+// or the new content.
 func (r *Registry) SaveLocalSchema(cachePath string, data []byte) error {
 	fullPath := filepath.Join(r.baseDir, cachePath)
 	dir := filepath.Dir(fullPath)
@@ -83,7 +196,7 @@ func (r *Registry) SaveLocalSchema(cachePath string, data []byte) error {
 		return err
 	}
 
-	return os.WriteFile(fullPath, data, config.DefaultFilePerm)
+	return writeFileAtomic(fullPath, data)
 }
 
 // GetLocalFileURI returns the formatted file:// URI for a known local cache path, without downloading.
@@ -92,48 +205,58 @@ func (r *Registry) GetLocalFileURI(cachePath string) string {
 	return fmt.Sprintf("file://%s", fullPath)
 }
 
-// GenerateCompositeSchema creates a single schema using 'anyOf' to aggregate multiple schemas.
-func (r *Registry) GenerateCompositeSchema(schemaURIs []string) (string, error) {
-	if len(schemaURIs) == 0 {
+// CompositeMember is a schema that applies to the documents of a composite
+// selected by its discriminator.
+type CompositeMember struct {
+	URI string
+
+	// Discriminator maps top-level fields to the values a document must
+	// have for URI to apply, e.g. apiVersion and kind. An empty
+	// discriminator applies URI to every document.
+	Discriminator map[string]string
+
+	// StartLine is the first line of the document the member was detected
+	// in, or zero if it was detected for the whole file.
+	StartLine int
+}
+
+// GenerateCompositeSchema creates a single schema that routes every document
+// of a multi-document file to its own member schema with if/then on the
+// members' discriminators, so documents are never validated against each
+// other's schemas. documents is the number of non-empty documents in the
+// file; documents no member was detected in are left unconstrained.
+func (r *Registry) GenerateCompositeSchema(members []CompositeMember, documents int) (string, error) {
+	covered := coversAll(members, documents)
+	members = uniqueMembers(members)
+	if len(members) == 0 {
 		return "", nil
 	}
-	// Fast path: if there is only one manifest, just return its schema directly.
-	if len(schemaURIs) == 1 {
-		return schemaURIs[0], nil
-	}
-
-	// Deduplicate and sort URIs to ensure a deterministic hash for identical documents
-	uriMap := make(map[string]bool)
-	var uniqueURIs []string
-	for _, uri := range schemaURIs {
-		if !uriMap[uri] {
-			uriMap[uri] = true
-			uniqueURIs = append(uniqueURIs, uri)
-		}
+	// Fast path: if all documents share one schema, just return it directly.
+	if covered && sameURI(members) {
+		return members[0].URI, nil
 	}
-	sort.Strings(uniqueURIs)
 
-	// Hash the sorted URIs
+	// Hash the sorted members to get a deterministic name for identical files
 	hash := sha256.New()
-	for _, uri := range uniqueURIs {
-		hash.Write([]byte(uri))
+	for _, m := range members {
+		hash.Write([]byte(m.key()))
 	}
 	hashStr := hex.EncodeToString(hash.Sum(nil))[:16]
 
-	cachePath := filepath.Join("composite", fmt.Sprintf("composite_%s.json", hashStr))
+	cachePath := filepath.Join(CompositeDir, fmt.Sprintf("composite_%s.json", hashStr))
 
 	// Fast path: check if this exact composite combination already exists
-	if _, err := os.Stat(r.GetLocalPath(cachePath)); err == nil {
-		return r.GetLocalFileURI(cachePath), nil
+	if localURI, ok := r.CachedFileURI(cachePath); ok {
+		return localURI, nil
 	}
 
 	// Build the wrapper
-	anyOf := make([]map[string]string, 0, len(uniqueURIs))
-	for _, uri := range uniqueURIs {
-		anyOf = append(anyOf, map[string]string{"$ref": uri})
+	allOf := make([]map[string]any, 0, len(members))
+	for _, m := range members {
+		allOf = append(allOf, m.rule())
 	}
 
-	composite := compositeSchema{AnyOf: anyOf}
+	composite := compositeSchema{Schema: compositeSchemaDraft, AllOf: allOf}
 	data, err := json.MarshalIndent(composite, "", "  ")
 	if err != nil {
 		return "", err
@@ -146,3 +269,85 @@ func (r *Registry) GenerateCompositeSchema(schemaURIs []string) (string, error)
 
 	return r.GetLocalFileURI(cachePath), nil
 }
+
+// uniqueMembers deduplicates members and sorts them deterministically.
+func uniqueMembers(members []CompositeMember) []CompositeMember {
+	seen := make(map[string]bool, len(members))
+	unique := make([]CompositeMember, 0, len(members))
+	for _, m := range members {
+		if m.URI == "" || seen[m.key()] {
+			continue
+		}
+		seen[m.key()] = true
+		unique = append(unique, m)
+	}
+
+	sort.Slice(unique, func(i, j int) bool { return unique[i].key() < unique[j].key() })
+	return unique
+}
+
+// coversAll reports whether members were detected in every one of the
+// file's documents.
+func coversAll(members []CompositeMember, documents int) bool {
+	covered := make(map[int]bool, len(members))
+	for _, m := range members {
+		if m.URI == "" {
+			continue
+		}
+		if m.StartLine == 0 && len(m.Discriminator) == 0 {
+			return true
+		}
+		covered[m.StartLine] = true
+	}
+	return len(covered) >= documents
+}
+
+func sameURI(members []CompositeMember) bool {
+	for _, m := range members[1:] {
+		if m.URI != members[0].URI {
+			return false
+		}
+	}
+	return true
+}
+
+// key identifies a member by its URI and discriminator.
+func (m CompositeMember) key() string {
+	fields := make([]string, 0, len(m.Discriminator))
+	for field := range m.Discriminator {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var b strings.Builder
+	b.WriteString(m.URI)
+	for _, field := range fields {
+		fmt.Fprintf(&b, "\x00%s=%s", field, m.Discriminator[field])
+	}
+	return b.String()
+}
+
+// rule returns the allOf entry that applies the member's schema to the
+// documents matching its discriminator.
+func (m CompositeMember) rule() map[string]any {
+	ref := map[string]any{"$ref": m.URI}
+	if len(m.Discriminator) == 0 {
+		return ref
+	}
+
+	properties := make(map[string]any, len(m.Discriminator))
+	required := make([]string, 0, len(m.Discriminator))
+	for field, value := range m.Discriminator {
+		properties[field] = map[string]any{"const": value}
+		required = append(required, field)
+	}
+	sort.Strings(required)
+
+	return map[string]any{
+		"if": map[string]any{
+			"properties": properties,
+			"required":   required,
+		},
+		"then": ref,
+	}
+}
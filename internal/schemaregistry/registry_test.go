@@ -0,0 +1,217 @@
+package schemaregistry_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/config"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+const (
+	deploymentURI = "file:///schemas/deployment.json"
+	serviceURI    = "file:///schemas/service.json"
+)
+
+// newTestRegistry returns a registry caching into a temporary directory.
+func newTestRegistry(t *testing.T, cfg *config.Config) *schemaregistry.Registry {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, "cache"))
+
+	registry, err := schemaregistry.NewRegistry(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func deployment(startLine int) schemaregistry.CompositeMember {
+	return schemaregistry.CompositeMember{
+		URI:           deploymentURI,
+		Discriminator: map[string]string{"apiVersion": "apps/v1", "kind": "Deployment"},
+		StartLine:     startLine,
+	}
+}
+
+func service(startLine int) schemaregistry.CompositeMember {
+	return schemaregistry.CompositeMember{
+		URI:           serviceURI,
+		Discriminator: map[string]string{"apiVersion": "v1", "kind": "Service"},
+		StartLine:     startLine,
+	}
+}
+
+// rule is the part of a composite's allOf entry the tests look at.
+type rule struct {
+	Ref string `json:"$ref"`
+	If  *struct {
+		Properties map[string]struct {
+			Const string `json:"const"`
+		} `json:"properties"`
+		Required []string `json:"required"`
+	} `json:"if"`
+	Then *struct {
+		Ref string `json:"$ref"`
+	} `json:"then"`
+}
+
+// readComposite reads the allOf entries of the composite schema at uri.
+func readComposite(t *testing.T, uri string) []rule {
+	t.Helper()
+
+	path, ok := fileuri.ToPath(uri)
+	if !ok {
+		t.Fatalf("composite URI %q is not a file URI", uri)
+	}
+	if !strings.Contains(path, string(filepath.Separator)+schemaregistry.CompositeDir+string(filepath.Separator)) {
+		t.Errorf("composite %s is not in the %s directory", path, schemaregistry.CompositeDir)
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // the path is in the test's cache directory
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var composite struct {
+		AllOf []rule `json:"allOf"`
+	}
+	if err := json.Unmarshal(data, &composite); err != nil {
+		t.Fatalf("invalid composite %s: %v", uri, err)
+	}
+	return composite.AllOf
+}
+
+func TestGenerateCompositeSchema(t *testing.T) {
+	tests := []struct {
+		name      string
+		members   []schemaregistry.CompositeMember
+		documents int
+
+		// wantURI is the returned URI, or empty if a composite is expected.
+		wantURI string
+		// wantThen are the schemas the composite applies conditionally, and
+		// wantAlways those it applies to every document.
+		wantThen   []string
+		wantAlways []string
+	}{
+		{
+			name:      "no members",
+			documents: 2,
+		},
+		{
+			name:      "members without schema",
+			members:   []schemaregistry.CompositeMember{{URI: ""}},
+			documents: 1,
+		},
+		{
+			name:      "one schema for the whole file",
+			members:   []schemaregistry.CompositeMember{{URI: deploymentURI}},
+			documents: 3,
+			wantURI:   deploymentURI,
+		},
+		{
+			name:      "one schema detected in every document",
+			members:   []schemaregistry.CompositeMember{deployment(1), deployment(20)},
+			documents: 2,
+			wantURI:   deploymentURI,
+		},
+		{
+			name:      "one schema detected in some documents",
+			members:   []schemaregistry.CompositeMember{deployment(1), deployment(20)},
+			documents: 3,
+			wantThen:  []string{deploymentURI},
+		},
+		{
+			name:      "schemas per document",
+			members:   []schemaregistry.CompositeMember{service(1), deployment(10)},
+			documents: 2,
+			wantThen:  []string{deploymentURI, serviceURI},
+		},
+		{
+			name:      "duplicate members",
+			members:   []schemaregistry.CompositeMember{deployment(1), service(10), deployment(20), service(30)},
+			documents: 4,
+			wantThen:  []string{deploymentURI, serviceURI},
+		},
+		{
+			name: "schema without discriminator",
+			members: []schemaregistry.CompositeMember{
+				{URI: serviceURI, StartLine: 1}, deployment(10),
+			},
+			documents:  3,
+			wantThen:   []string{deploymentURI},
+			wantAlways: []string{serviceURI},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := newTestRegistry(t, config.Default())
+
+			uri, err := registry.GenerateCompositeSchema(tt.members, tt.documents)
+			if err != nil {
+				t.Fatalf("GenerateCompositeSchema() error = %v", err)
+			}
+			if tt.wantThen == nil && tt.wantAlways == nil {
+				if uri != tt.wantURI {
+					t.Errorf("GenerateCompositeSchema() = %q, want %q", uri, tt.wantURI)
+				}
+				return
+			}
+
+			var then, always []string
+			for _, r := range readComposite(t, uri) {
+				if r.If == nil {
+					always = append(always, r.Ref)
+					continue
+				}
+				if len(r.If.Required) != len(r.If.Properties) {
+					t.Errorf("rule for %s requires %v of %v", r.Then.Ref, r.If.Required, r.If.Properties)
+				}
+				if r.If.Properties["kind"].Const == "" {
+					t.Errorf("rule for %s does not discriminate on kind", r.Then.Ref)
+				}
+				then = append(then, r.Then.Ref)
+			}
+			if strings.Join(then, ",") != strings.Join(tt.wantThen, ",") {
+				t.Errorf("conditional schemas = %v, want %v", then, tt.wantThen)
+			}
+			if strings.Join(always, ",") != strings.Join(tt.wantAlways, ",") {
+				t.Errorf("unconditional schemas = %v, want %v", always, tt.wantAlways)
+			}
+		})
+	}
+}
+
+func TestGenerateCompositeSchemaDeterministic(t *testing.T) {
+	registry := newTestRegistry(t, config.Default())
+
+	first, err := registry.GenerateCompositeSchema([]schemaregistry.CompositeMember{service(1), deployment(10)}, 2)
+	if err != nil {
+		t.Fatalf("GenerateCompositeSchema() error = %v", err)
+	}
+
+	// The order of the documents and their lines don't change the composite
+	second, err := registry.GenerateCompositeSchema([]schemaregistry.CompositeMember{deployment(1), service(40)}, 2)
+	if err != nil {
+		t.Fatalf("GenerateCompositeSchema() error = %v", err)
+	}
+	if first != second {
+		t.Errorf("GenerateCompositeSchema() = %q and %q, want the same composite", first, second)
+	}
+
+	// Other members get their own composite
+	other, err := registry.GenerateCompositeSchema([]schemaregistry.CompositeMember{deployment(1)}, 2)
+	if err != nil {
+		t.Fatalf("GenerateCompositeSchema() error = %v", err)
+	}
+	if other == first {
+		t.Errorf("GenerateCompositeSchema() of other members = %q, want a different composite", other)
+	}
+}
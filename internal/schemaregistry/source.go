@@ -0,0 +1,167 @@
+package schemaregistry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Placeholders of source URL templates and catalog layouts.
+const (
+	// PlaceholderKubernetesVersion is the Kubernetes version, e.g. "v1.29.0".
+	PlaceholderKubernetesVersion = "{kubernetesVersion}"
+	// PlaceholderFlavour is the registry directory suffix of the schema
+	// flavour, e.g. "-standalone-strict".
+	PlaceholderFlavour = "{flavour}"
+	// PlaceholderGroup is the API group, e.g. "apps". It is empty for core kinds.
+	PlaceholderGroup = "{group}"
+	// PlaceholderVersion is the API version, e.g. "v1".
+	PlaceholderVersion = "{version}"
+	// PlaceholderKind is the lowercase kind, e.g. "deployment".
+	PlaceholderKind = "{kind}"
+	// PlaceholderAPIVersion is the apiVersion, e.g. "apps/v1" or "v1".
+	PlaceholderAPIVersion = "{apiVersion}"
+	// PlaceholderGroupVersion is the group and version in the file name style
+	// of kubernetes-json-schema, e.g. "apps-v1", "rbac-v1" or "v1".
+	PlaceholderGroupVersion = "{groupVersion}"
+)
+
+// Catalog is a family of schemas, such as the built-in Kubernetes kinds, that
+// one or more mirrors serve with the same file layout.
+type Catalog struct {
+	// Name is the directory of the catalog in the cache.
+	Name string
+
+	// Layout is the path template of a schema below a source's base URL and
+	// below the catalog's cache directory.
+	Layout string
+
+	// Sources are tried in order until one has the schema. A source with
+	// placeholders is the URL template of a schema; any other source is a
+	// base URL the Layout is appended to. Both http(s):// and file:// URLs
+	// are supported.
+	Sources []string
+}
+
+// SchemaRef identifies a schema within a catalog by its group, version and
+// kind, plus the Kubernetes version and flavour the schema was built for.
+type SchemaRef struct {
+	Group   string
+	Version string
+	Kind    string
+
+	KubernetesVersion string
+	Flavour           string
+}
+
+// NewCatalog returns a catalog trying mirrors first, in order, and the
+// primary source last. Empty sources are skipped.
+func NewCatalog(name, layout string, mirrors []string, primary string) Catalog {
+	sources := make([]string, 0, len(mirrors)+1)
+	for _, source := range append(append([]string(nil), mirrors...), primary) {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, source)
+		}
+	}
+
+	return Catalog{Name: name, Layout: layout, Sources: sources}
+}
+
+// Lookup returns the file:// URI of the cached schema ref points to,
+// downloading it from the first source that has it on a cache miss.
+func (r *Registry) Lookup(ctx context.Context, catalog Catalog, ref SchemaRef) (string, error) {
+	return r.fetch(ctx, catalog.urls(ref), catalog.cachePath(ref))
+}
+
+// LookupSibling is like Lookup for the file named fileName next to the schema
+// ref points to, such as the _definitions.json that schemas reference
+// relative to their own location.
+func (r *Registry) LookupSibling(ctx context.Context, catalog Catalog, ref SchemaRef, fileName string) (string, error) {
+	urls := catalog.urls(ref)
+	for i, u := range urls {
+		urls[i] = u[:strings.LastIndex(u, "/")+1] + fileName
+	}
+
+	return r.fetch(ctx, urls, filepath.Join(filepath.Dir(catalog.cachePath(ref)), fileName))
+}
+
+// urls expands the sources of the catalog for ref.
+func (c Catalog) urls(ref SchemaRef) []string {
+	urls := make([]string, 0, len(c.Sources))
+	for _, source := range c.Sources {
+		template := source
+		if !strings.Contains(source, "{") {
+			template = strings.TrimSuffix(source, "/") + "/" + c.Layout
+		}
+		urls = append(urls, ref.expand(template))
+	}
+	return urls
+}
+
+// cachePath returns where the schema of ref is kept, whichever source it
+// came from.
+func (c Catalog) cachePath(ref SchemaRef) string {
+	return filepath.Join(c.Name, filepath.FromSlash(path.Clean("/"+ref.expand(c.Layout))))
+}
+
+// expand replaces the placeholders of template. Values are path escaped, so
+// a slash in them can't add directories.
+func (ref SchemaRef) expand(template string) string {
+	group := url.PathEscape(ref.Group)
+	version := url.PathEscape(ref.Version)
+
+	apiVersion, groupVersion := version, version
+	if group != "" {
+		apiVersion = group + "/" + version
+		shortGroup, _, _ := strings.Cut(group, ".")
+		groupVersion = shortGroup + "-" + version
+	}
+
+	return strings.NewReplacer(
+		PlaceholderKubernetesVersion, url.PathEscape(ref.KubernetesVersion),
+		PlaceholderFlavour, url.PathEscape(ref.Flavour),
+		PlaceholderGroup, group,
+		PlaceholderVersion, version,
+		PlaceholderKind, url.PathEscape(strings.ToLower(ref.Kind)),
+		PlaceholderAPIVersion, apiVersion,
+		PlaceholderGroupVersion, groupVersion,
+	).Replace(template)
+}
+
+// fetch returns the schema at cachePath, downloading it from the first of
+// urls that serves it on a cache miss.
+func (r *Registry) fetch(ctx context.Context, urls []string, cachePath string) (string, error) {
+	if len(urls) == 0 {
+		if _, err := os.Stat(r.GetLocalPath(cachePath)); err == nil {
+			return r.GetLocalFileURI(cachePath), nil
+		}
+		if localURI, ok := r.fromPack(cachePath, ""); ok {
+			return localURI, nil
+		}
+		return "", fmt.Errorf("no schema source configured for %s", cachePath)
+	}
+
+	var errs []error
+	for _, remoteURL := range urls {
+		localURI, err := r.GetSchemaURI(ctx, remoteURL, cachePath)
+		if err == nil {
+			return localURI, nil
+		}
+		if ctx.Err() != nil {
+			return "", err
+		}
+		errs = append(errs, err)
+	}
+
+	// Schema packs are the last resort, e.g. on a machine that is offline
+	if localURI, ok := r.fromPack(cachePath, urls[0]); ok {
+		return localURI, nil
+	}
+
+	return "", errors.Join(errs...)
+}
@@ -0,0 +1,77 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidSchema is returned for downloads that are not a JSON Schema, such
+// as the HTML page of a captive portal or a truncated response.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// supportedDrafts are the JSON Schema drafts the language server understands,
+// as they appear in "$schema" URIs.
+var supportedDrafts = []string{"draft-03", "draft-04", "draft-06", "draft-07", "2019-09", "2020-12"}
+
+// jsonSchemaHost publishes the meta-schemas of all drafts.
+const jsonSchemaHost = "json-schema.org"
+
+// schemaKeywords are keywords of which a schema document has at least one at
+// its root. The schemas of the Kubernetes registries don't declare "$schema".
+var schemaKeywords = []string{
+	"$schema", "$ref", "$id", "id", "type", "properties", "definitions", "$defs",
+	"allOf", "anyOf", "oneOf", "items", "enum", "additionalProperties",
+}
+
+// validateSchema checks that data is a JSON object that looks like a JSON
+// Schema of a supported draft.
+func validateSchema(data []byte, maxSize int) error {
+	if maxSize > 0 && len(data) > maxSize {
+		return fmt.Errorf("%w: larger than %d bytes", ErrInvalidSchema, maxSize)
+	}
+
+	var document map[string]json.RawMessage
+	if err := json.Unmarshal(data, &document); err != nil {
+		return fmt.Errorf("%w: not a JSON object: %w", ErrInvalidSchema, err)
+	}
+
+	if raw, ok := document["$schema"]; ok {
+		var draft string
+		if err := json.Unmarshal(raw, &draft); err != nil {
+			return fmt.Errorf("%w: $schema is not a string", ErrInvalidSchema)
+		}
+		if !supportedDraft(draft) {
+			return fmt.Errorf("%w: unsupported $schema %q", ErrInvalidSchema, draft)
+		}
+		return nil
+	}
+
+	for _, keyword := range schemaKeywords {
+		if _, ok := document[keyword]; ok {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no JSON Schema keywords at the root", ErrInvalidSchema)
+}
+
+// supportedDraft reports whether a "$schema" URI is one of the meta-schemas
+// of json-schema.org, including "http://json-schema.org/schema#" for the
+// latest draft, or names a supported draft. Meta-schemas of other sites are
+// rejected, as the language server would not understand them.
+func supportedDraft(draft string) bool {
+	if u, err := url.Parse(draft); err == nil && (u.Scheme == "http" || u.Scheme == "https") &&
+		strings.TrimPrefix(u.Hostname(), "www.") == jsonSchemaHost {
+		return true
+	}
+
+	for _, supported := range supportedDrafts {
+		if strings.Contains(draft, supported) {
+			return true
+		}
+	}
+	return false
+}
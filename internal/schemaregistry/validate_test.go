@@ -0,0 +1,42 @@
+package schemaregistry_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+)
+
+func TestValidateSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "draft-07", data: `{"$schema": "http://json-schema.org/draft-07/schema#"}`},
+		{name: "2020-12", data: `{"$schema": "https://json-schema.org/draft/2020-12/schema"}`},
+		{name: "latest draft", data: `{"$schema": "http://json-schema.org/schema#"}`},
+		{name: "www host", data: `{"$schema": "https://www.json-schema.org/schema"}`},
+		{name: "draft on another host", data: `{"$schema": "https://schemas.example.com/draft-07/schema"}`},
+		{name: "keywords without $schema", data: `{"type": "object", "properties": {}}`},
+		{name: "foreign meta-schema", data: `{"$schema": "https://spec.openapis.org/oas/3.1/dialect/base"}`, wantErr: true},
+		{name: "lookalike host", data: `{"$schema": "https://json-schema.org.example.com/schema"}`, wantErr: true},
+		{name: "$schema not a string", data: `{"$schema": 7}`, wantErr: true},
+		{name: "no keywords", data: `{"name": "widget"}`, wantErr: true},
+		{name: "not an object", data: `<html></html>`, wantErr: true},
+		{name: "too large", data: `{"type": "object", "description": "` + strings.Repeat("x", 64) + `"}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schemaregistry.ValidateSchema([]byte(tt.data), 64)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("validateSchema() error = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, schemaregistry.ErrInvalidSchema) {
+				t.Errorf("validateSchema() error = %v, want %v", err, schemaregistry.ErrInvalidSchema)
+			}
+		})
+	}
+}
@@ -0,0 +1,7 @@
+package validation
+
+// ToInstance and Locate expose toInstance and locate to the tests.
+var (
+	ToInstance = toInstance
+	Locate     = locate
+)
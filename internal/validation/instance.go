@@ -0,0 +1,160 @@
+package validation
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// mergeKey is the YAML merge key, e.g. "<<: *defaults".
+const mergeKey = "<<"
+
+// toInstance converts a parsed YAML document into the JSON value the
+// language server validates: aliases are expanded, merge keys applied, and
+// timestamps and custom tags kept as strings.
+func toInstance(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return toInstance(node.Content[0])
+	case yaml.AliasNode:
+		return toInstance(node.Alias)
+	case yaml.SequenceNode:
+		items := make([]any, 0, len(node.Content))
+		for _, child := range node.Content {
+			item, err := toInstance(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		object := make(map[string]any, len(node.Content)/2)
+		for _, pair := range mappingPairs(node) {
+			value, err := toInstance(pair.value)
+			if err != nil {
+				return nil, err
+			}
+			object[pair.key.Value] = value
+		}
+		return object, nil
+	case yaml.ScalarNode:
+		return scalarInstance(node)
+	default:
+		return nil, fmt.Errorf("line %d: unsupported YAML node", node.Line)
+	}
+}
+
+func scalarInstance(node *yaml.Node) (any, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		return strconv.ParseBool(node.Value)
+	case "!!int", "!!float":
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		return value, nil
+	default:
+		return node.Value, nil
+	}
+}
+
+// pair is a key and value of a mapping.
+type pair struct {
+	key, value *yaml.Node
+}
+
+// mappingPairs returns the entries of a mapping node with the entries of
+// merge keys applied. Explicit keys take precedence over merged ones.
+func mappingPairs(mapping *yaml.Node) []pair {
+	var explicit, merged []pair
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if key.Value != mergeKey || key.ShortTag() != "!!merge" {
+			explicit = append(explicit, pair{key, value})
+			continue
+		}
+
+		value = resolveAlias(value)
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, source := range sources {
+			if source = resolveAlias(source); source.Kind == yaml.MappingNode {
+				merged = append(merged, mappingPairs(source)...)
+			}
+		}
+	}
+
+	seen := make(map[string]bool, len(explicit))
+	for _, p := range explicit {
+		seen[p.key.Value] = true
+	}
+	pairs := explicit
+	for _, p := range merged {
+		if !seen[p.key.Value] {
+			seen[p.key.Value] = true
+			pairs = append(pairs, p)
+		}
+	}
+	return pairs
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// locate returns the line and column of the value at location in a parsed
+// document, or of the key named key inside it if it is not empty. It stops
+// at the deepest node it can find.
+func locate(doc *yaml.Node, location []string, key string) (line, column int) {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, token := range location {
+		next := child(resolveAlias(node), token)
+		if next == nil {
+			break
+		}
+		node = next
+	}
+
+	if key != "" {
+		for _, p := range mappingPairs(resolveAlias(node)) {
+			if p.key.Value == key {
+				return p.key.Line, p.key.Column
+			}
+		}
+	}
+	return node.Line, node.Column
+}
+
+// child returns the value of a mapping key or a sequence index, or nil.
+func child(node *yaml.Node, token string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for _, p := range mappingPairs(node) {
+			if p.key.Value == token {
+				return p.value
+			}
+		}
+	case yaml.SequenceNode:
+		if i, err := strconv.Atoi(token); err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package validation_test
+
+import (
+	"reflect"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+
+	"go.trai.ch/yaml-schema-router/internal/validation"
+)
+
+func parse(t *testing.T, content string) *yaml.Node {
+	t.Helper()
+
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &node); err != nil {
+		t.Fatalf("invalid test document: %v", err)
+	}
+	return &node
+}
+
+func TestToInstance(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    any
+	}{
+		{
+			name:    "null document",
+			content: "~\n",
+			want:    nil,
+		},
+		{
+			name:    "scalars",
+			content: "int: 3\nfloat: 1.5\nbool: true\nnull: ~\nquoted: \"3\"\nstring: text\n",
+			want: map[string]any{
+				"int": 3, "float": 1.5, "bool": true, "null": nil, "quoted": "3", "string": "text",
+			},
+		},
+		{
+			name:    "timestamps and custom tags stay strings",
+			content: "created: 2024-01-02T03:04:05Z\nsecret: !vault abc\n",
+			want:    map[string]any{"created": "2024-01-02T03:04:05Z", "secret": "abc"},
+		},
+		{
+			name:    "aliases",
+			content: "base: &port 8080\nports: [*port, 9090]\nlabels: &labels {app: web}\ncopy: *labels\n",
+			want: map[string]any{
+				"base":   8080,
+				"ports":  []any{8080, 9090},
+				"labels": map[string]any{"app": "web"},
+				"copy":   map[string]any{"app": "web"},
+			},
+		},
+		{
+			name:    "merge key",
+			content: "defaults: &defaults {replicas: 1, image: web}\nspec:\n  <<: *defaults\n  replicas: 3\n",
+			want: map[string]any{
+				"defaults": map[string]any{"replicas": 1, "image": "web"},
+				"spec":     map[string]any{"replicas": 3, "image": "web"},
+			},
+		},
+		{
+			name:    "explicit keys win regardless of order",
+			content: "a: &a {x: 1, y: 1}\nb:\n  x: 2\n  <<: *a\n",
+			want: map[string]any{
+				"a": map[string]any{"x": 1, "y": 1},
+				"b": map[string]any{"x": 2, "y": 1},
+			},
+		},
+		{
+			name:    "merge sequence prefers earlier mappings",
+			content: "a: &a {x: 1}\nb: &b {x: 2, y: 2}\nc:\n  <<: [*a, *b]\n",
+			want: map[string]any{
+				"a": map[string]any{"x": 1},
+				"b": map[string]any{"x": 2, "y": 2},
+				"c": map[string]any{"x": 1, "y": 2},
+			},
+		},
+		{
+			name:    "nested merges",
+			content: "a: &a {x: 1}\nb: &b\n  <<: *a\n  y: 2\nc:\n  <<: *b\n  z: 3\n",
+			want: map[string]any{
+				"a": map[string]any{"x": 1},
+				"b": map[string]any{"x": 1, "y": 2},
+				"c": map[string]any{"x": 1, "y": 2, "z": 3},
+			},
+		},
+		{
+			name:    "inline merged mapping",
+			content: "spec:\n  <<: {replicas: 1}\n",
+			want:    map[string]any{"spec": map[string]any{"replicas": 1}},
+		},
+		{
+			name:    "quoted merge key is a plain key",
+			content: "spec:\n  \"<<\": {replicas: 1}\n",
+			want:    map[string]any{"spec": map[string]any{"<<": map[string]any{"replicas": 1}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validation.ToInstance(parse(t, tt.content))
+			if err != nil {
+				t.Fatalf("toInstance() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("toInstance() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocate(t *testing.T) {
+	doc := parse(t, "defaults: &defaults\n  image: web\nspec:\n  <<: *defaults\n  replicas: 3\n  ports:\n    - 80\n")
+
+	tests := []struct {
+		name       string
+		location   []string
+		key        string
+		wantLine   int
+		wantColumn int
+	}{
+		{name: "document", location: nil, wantLine: 1, wantColumn: 1},
+		{name: "value", location: []string{"spec", "replicas"}, wantLine: 5, wantColumn: 13},
+		{name: "key", location: []string{"spec"}, key: "replicas", wantLine: 5, wantColumn: 3},
+		{name: "sequence item", location: []string{"spec", "ports", "0"}, wantLine: 7, wantColumn: 7},
+		{name: "merged key", location: []string{"spec"}, key: "image", wantLine: 2, wantColumn: 3},
+		{name: "missing stops at the deepest node", location: []string{"spec", "missing"}, wantLine: 4, wantColumn: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, column := validation.Locate(doc, tt.location, tt.key)
+			if line != tt.wantLine || column != tt.wantColumn {
+				t.Errorf("locate() = %d:%d, want %d:%d", line, column, tt.wantLine, tt.wantColumn)
+			}
+		})
+	}
+}
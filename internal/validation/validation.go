@@ -0,0 +1,374 @@
+// Package validation validates YAML files against the schemas the detector
+// chain routes them to, the way the language server does in an editor.
+package validation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/fileuri"
+	"go.trai.ch/yaml-schema-router/internal/schemaregistry"
+	"go.trai.ch/yaml-schema-router/internal/yamldoc"
+)
+
+// printer formats validation errors.
+var printer = message.NewPrinter(language.English)
+
+// syntaxErrorLine matches the line number of YAML syntax errors.
+var syntaxErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+// Finding is a problem in a YAML file.
+type Finding struct {
+	// Line and Column are 1-based. Column is zero if unknown.
+	Line   int
+	Column int
+
+	// Path is the JSON pointer of the offending value, e.g. "/spec/replicas".
+	// It is empty for syntax errors.
+	Path string
+
+	Message string
+
+	// Schema is the URI of the schema the document violates. It is empty for
+	// syntax errors.
+	Schema string
+
+	// Syntax is set for YAML syntax errors.
+	Syntax bool
+}
+
+// Result is the outcome of validating a file.
+type Result struct {
+	Path string
+
+	// Schema is the URI of the schema the file was validated against. It is
+	// empty if no detector claimed the file.
+	Schema string
+
+	// Annotation is the schema of a manual schema annotation. Such files are
+	// left to the language server and not validated.
+	Annotation string
+
+	// Documents is the number of YAML documents in the file.
+	Documents int
+
+	Findings []Finding
+
+	// Err is set if the file could not be validated at all, e.g. because its
+	// schema does not compile.
+	Err error
+}
+
+// Failed reports whether the file has findings or could not be validated.
+func (r Result) Failed() bool {
+	return r.Err != nil || len(r.Findings) > 0
+}
+
+// Validator validates files with the schemas of a detector chain.
+type Validator struct {
+	// AllowUnresolved skips documents whose schema could not be fetched
+	// instead of failing the file.
+	AllowUnresolved bool
+
+	registry *schemaregistry.Registry
+	chain    *detector.Chain
+
+	mu       sync.Mutex
+	compiler *jsonschema.Compiler
+	schemas  map[string]*jsonschema.Schema
+}
+
+// NewValidator returns a validator routing files through chain and reading
+// their schemas from the registry cache.
+func NewValidator(registry *schemaregistry.Registry, chain *detector.Chain) *Validator {
+	compiler := jsonschema.NewCompiler()
+	compiler.UseLoader(jsonschema.SchemeURLLoader{"file": jsonschema.FileLoader{}})
+	// The language server, like most schemas of the registries, assumes draft-07
+	compiler.DefaultDraft(jsonschema.Draft7)
+	compiler.UseRegexpEngine(lenientRegexp)
+
+	return &Validator{
+		registry: registry,
+		chain:    chain,
+		compiler: compiler,
+		schemas:  make(map[string]*jsonschema.Schema),
+	}
+}
+
+// ValidateFile detects the schemas of the file at path like the proxy does
+// for an open document and validates each of its documents against the
+// schema detected for it. Documents without a schema are skipped. Documents
+// a detector recognized but could not fetch the schema of fail the file,
+// unless AllowUnresolved is set.
+func (v *Validator) ValidateFile(ctx context.Context, path string) Result {
+	result := Result{Path: path}
+
+	content, err := os.ReadFile(path) //nolint:gosec // the path is given on the command line
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	docs := yamldoc.Split(content)
+	result.Documents = len(docs)
+	if schema, annotated := detector.SchemaAnnotation(content); annotated {
+		result.Annotation = schema
+		return result
+	}
+
+	matches, unresolved, err := v.detect(ctx, path, content)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if len(unresolved) > 0 && !v.AllowUnresolved {
+		result.Err = errors.Join(unresolved...)
+	}
+	if len(matches) == 0 {
+		return result
+	}
+	if result.Schema, err = v.registry.GenerateCompositeSchema(compositeMembers(matches), len(docs)); err != nil {
+		result.Err = errors.Join(result.Err, err)
+		return result
+	}
+
+	for _, doc := range docs {
+		findings, err := v.validateDocument(doc, matches)
+		if err != nil {
+			result.Err = errors.Join(result.Err, err)
+			return result
+		}
+		result.Findings = append(result.Findings, findings...)
+	}
+	sort.SliceStable(result.Findings, func(i, j int) bool {
+		a, b := result.Findings[i], result.Findings[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	return result
+}
+
+// detect returns the schemas the detector chain routes the file to, and the
+// documents whose schema could not be fetched.
+func (v *Validator) detect(ctx context.Context, path string, content []byte) ([]detector.Match, []error, error) {
+	uri, err := fileuri.FromPath(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	matches, unresolved, err := v.chain.RunAll(ctx, uri, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	errs := make([]error, 0, len(unresolved))
+	for _, u := range unresolved {
+		errs = append(errs, u)
+	}
+	return matches, errs, nil
+}
+
+// validateDocument validates doc against the schemas of the matches covering
+// it. Syntax errors are reported for every document, as the language server
+// reports them regardless of schemas.
+func (v *Validator) validateDocument(doc yamldoc.Document, matches []detector.Match) ([]Finding, error) {
+	if doc.Err != nil {
+		return []Finding{syntaxFinding(doc)}, nil
+	}
+
+	var findings []Finding
+	for _, m := range matches {
+		if !covers(m, doc) {
+			continue
+		}
+
+		schema, err := v.compile(m.SchemaURI)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, validateInstance(schema, m.SchemaURI, doc)...)
+	}
+	return findings, nil
+}
+
+// covers reports whether m was detected for doc, either as the schema of the
+// whole file or of the lines doc spans.
+func covers(m detector.Match, doc yamldoc.Document) bool {
+	if m.StartLine == 0 {
+		return true
+	}
+	return m.StartLine <= doc.EndLine && doc.StartLine <= m.EndLine
+}
+
+// compositeMembers returns the members of the composite schema the proxy
+// would configure for matches.
+func compositeMembers(matches []detector.Match) []schemaregistry.CompositeMember {
+	members := make([]schemaregistry.CompositeMember, 0, len(matches))
+	for _, m := range matches {
+		members = append(members, schemaregistry.CompositeMember{
+			URI: m.SchemaURI, Discriminator: m.Discriminator, StartLine: m.StartLine,
+		})
+	}
+	return members
+}
+
+// compile returns the compiled schema at uri. Compiled schemas are reused,
+// as files of a repository share most of them.
+func (v *Validator) compile(uri string) (*jsonschema.Schema, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if schema, ok := v.schemas[uri]; ok {
+		return schema, nil
+	}
+
+	schema, err := v.compiler.Compile(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile schema %s: %w", uri, err)
+	}
+	v.schemas[uri] = schema
+	return schema, nil
+}
+
+// validateInstance validates a single parsed YAML document.
+func validateInstance(schema *jsonschema.Schema, schemaURI string, doc yamldoc.Document) []Finding {
+	instance, err := toInstance(doc.Node)
+	if err != nil {
+		return []Finding{{Line: doc.StartLine, Message: err.Error()}}
+	}
+
+	err = schema.Validate(instance)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return []Finding{{Line: doc.StartLine, Message: err.Error(), Schema: schemaURI}}
+	}
+
+	var findings []Finding
+	collectFindings(validationErr, func(location []string, node, msg string) {
+		line, column := locate(doc.Node, location, node)
+		findings = append(findings, Finding{
+			Line:    line,
+			Column:  column,
+			Path:    jsonPointer(location),
+			Message: msg,
+			Schema:  schemaURI,
+		})
+	})
+	return findings
+}
+
+// collectFindings calls add for every leaf of a validation error tree, which
+// are the errors a user can act on. The branches of anyOf and oneOf are
+// summarized in one finding, as only one of them is meant to match. For
+// additional properties, node names the first offending key.
+func collectFindings(err *jsonschema.ValidationError, add func(location []string, node, msg string)) {
+	switch k := err.ErrorKind.(type) {
+	case *kind.AnyOf, *kind.OneOf:
+		if len(err.Causes) > 0 {
+			add(err.InstanceLocation, "", k.LocalizedString(printer)+": "+strings.Join(branchMessages(err), "; "))
+			return
+		}
+	case *kind.AdditionalProperties:
+		if len(err.Causes) == 0 && len(k.Properties) > 0 {
+			add(err.InstanceLocation, k.Properties[0], k.LocalizedString(printer))
+			return
+		}
+	}
+
+	if len(err.Causes) == 0 {
+		add(err.InstanceLocation, "", err.ErrorKind.LocalizedString(printer))
+		return
+	}
+	for _, cause := range err.Causes {
+		collectFindings(cause, add)
+	}
+}
+
+// branchMessages returns the distinct messages of the leaves below err,
+// prefixed with their location relative to err.
+func branchMessages(err *jsonschema.ValidationError) []string {
+	var messages []string
+	seen := make(map[string]bool)
+
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				walk(cause)
+			}
+			return
+		}
+
+		msg := e.ErrorKind.LocalizedString(printer)
+		if rel := e.InstanceLocation[len(err.InstanceLocation):]; len(rel) > 0 {
+			msg = jsonPointer(rel) + ": " + msg
+		}
+		if !seen[msg] {
+			seen[msg] = true
+			messages = append(messages, msg)
+		}
+	}
+	walk(err)
+
+	return messages
+}
+
+// syntaxFinding reports the syntax error of a document at its line in the
+// file. Errors without a line are reported at the start of the document.
+func syntaxFinding(doc yamldoc.Document) Finding {
+	finding := Finding{Line: doc.StartLine, Message: doc.Err.Error(), Syntax: true}
+
+	if m := syntaxErrorLine.FindStringSubmatch(doc.Err.Error()); m != nil {
+		if line, err := strconv.Atoi(m[1]); err == nil {
+			finding.Line = doc.StartLine + line - 1
+			finding.Message = m[2]
+		}
+	}
+	finding.Message = "syntax error: " + finding.Message
+
+	return finding
+}
+
+// jsonPointer joins the tokens of an instance location.
+func jsonPointer(tokens []string) string {
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(strings.NewReplacer("~", "~0", "/", "~1").Replace(token))
+	}
+	return b.String()
+}
+
+// anyString is the pattern of a regular expression Go can't compile.
+type anyString string
+
+func (p anyString) MatchString(string) bool { return true }
+func (p anyString) String() string          { return string(p) }
+
+// lenientRegexp compiles patterns with Go's regexp package. Patterns using
+// ECMAScript features Go lacks, such as lookaheads, match any string instead
+// of failing the whole schema, since the language server accepts them.
+func lenientRegexp(pattern string) (jsonschema.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return anyString(pattern), nil //nolint:nilerr // unsupported patterns are skipped on purpose
+	}
+	return re, nil
+}
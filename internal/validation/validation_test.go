@@ -0,0 +1,58 @@
+package validation_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/detector"
+	"go.trai.ch/yaml-schema-router/internal/validation"
+)
+
+// offlineDetector recognizes every file but can't fetch its schema.
+type offlineDetector struct{}
+
+func (offlineDetector) Name() string { return "offline" }
+
+func (offlineDetector) Detect(context.Context, string, []byte) ([]detector.Match, error) {
+	return nil, &detector.UnresolvedError{
+		Subject:   "apps/v1 Deployment",
+		StartLine: 1,
+		EndLine:   2,
+		Err:       errors.New("connection refused"),
+	}
+}
+
+func TestValidateFileUnresolved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte("apiVersion: apps/v1\nkind: Deployment\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		allowUnresolved bool
+		wantFailed      bool
+	}{
+		{name: "fails by default", wantFailed: true},
+		{name: "allowed", allowUnresolved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := validation.NewValidator(nil, detector.NewChain(offlineDetector{}))
+			validator.AllowUnresolved = tt.allowUnresolved
+
+			result := validator.ValidateFile(t.Context(), path)
+			if result.Failed() != tt.wantFailed {
+				t.Fatalf("ValidateFile() failed = %t (%v), want %t", result.Failed(), result.Err, tt.wantFailed)
+			}
+			var unresolved *detector.UnresolvedError
+			if tt.wantFailed && (!errors.As(result.Err, &unresolved) || unresolved.Detector != "offline") {
+				t.Errorf("ValidateFile() error = %v, want the unresolved Deployment", result.Err)
+			}
+		})
+	}
+}
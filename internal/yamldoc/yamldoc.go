@@ -0,0 +1,128 @@
+// Package yamldoc splits YAML streams into their documents and parses each
+// one on its own, so a syntax error in one document does not hide the others.
+package yamldoc
+
+import (
+	"bytes"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Document is a single document of a YAML stream.
+type Document struct {
+	// Index is the position of the document among the non-empty documents of the stream.
+	Index int
+
+	// StartLine and EndLine are the 1-based, inclusive lines the document spans.
+	StartLine int
+	EndLine   int
+
+	// Content holds the raw lines of the document, including its start marker.
+	Content []byte
+
+	// Node is the parsed document with line numbers relative to the whole
+	// stream. It is nil if the document has syntax errors.
+	Node *yaml.Node
+
+	// Err holds the syntax error, if any.
+	Err error
+}
+
+// Split returns the non-empty documents of a YAML stream. Documents are
+// separated by "---" and "..." markers at the start of a line, which YAML
+// forbids anywhere else, so markers inside block scalars, quoted strings or
+// longer rulers such as "----" are not mistaken for separators.
+func Split(content []byte) []Document {
+	var docs []Document
+
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	// A trailing newline terminates the last line rather than starting a new one.
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	start := 0
+
+	flush := func(end int) {
+		if doc, ok := newDocument(lines[start:end], start+1, len(docs)); ok {
+			docs = append(docs, doc)
+		}
+		start = end
+	}
+
+	for i, line := range lines {
+		switch {
+		case isMarker(line, "---"):
+			// The start marker belongs to the document it opens.
+			flush(i)
+		case isMarker(line, "..."):
+			// The end marker belongs to the document it closes.
+			flush(i + 1)
+		}
+	}
+	flush(len(lines))
+
+	return docs
+}
+
+// isMarker reports whether line is the given document marker, optionally
+// followed by whitespace and further content.
+func isMarker(line []byte, marker string) bool {
+	rest, ok := bytes.CutPrefix(line, []byte(marker))
+	if !ok {
+		return false
+	}
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r' || rest[0] == '\n'
+}
+
+// newDocument parses the given lines. It returns false for documents without
+// any content besides markers, comments and whitespace.
+func newDocument(lines [][]byte, startLine, index int) (Document, bool) {
+	if len(lines) == 0 || isBlank(lines) {
+		return Document{}, false
+	}
+
+	content := bytes.Join(lines, nil)
+	doc := Document{
+		Index:     index,
+		StartLine: startLine,
+		EndLine:   startLine + len(lines) - 1,
+		Content:   content,
+	}
+
+	var node yaml.Node
+	if err := yaml.Unmarshal(content, &node); err != nil {
+		doc.Err = err
+		return doc, true
+	}
+
+	offsetLines(&node, startLine-1)
+	doc.Node = &node
+
+	return doc, true
+}
+
+// isBlank reports whether the lines hold nothing but markers, comments and whitespace.
+func isBlank(lines [][]byte) bool {
+	for _, line := range lines {
+		trimmed := bytes.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			continue
+		}
+		if isMarker(trimmed, "---") && len(bytes.TrimSpace(trimmed[len("---"):])) == 0 {
+			continue
+		}
+		if isMarker(trimmed, "...") {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// offsetLines shifts the line numbers of node and its children by offset.
+func offsetLines(node *yaml.Node, offset int) {
+	node.Line += offset
+	for _, child := range node.Content {
+		offsetLines(child, offset)
+	}
+}
@@ -0,0 +1,139 @@
+package yamldoc_test
+
+import (
+	"testing"
+
+	"go.trai.ch/yaml-schema-router/internal/yamldoc"
+)
+
+// span is the line range of a document and whether it parsed.
+type span struct {
+	start, end int
+	valid      bool
+}
+
+func spans(t *testing.T, docs []yamldoc.Document) []span {
+	t.Helper()
+
+	got := make([]span, 0, len(docs))
+	for i, doc := range docs {
+		if doc.Index != i {
+			t.Errorf("document %d has Index %d", i, doc.Index)
+		}
+		if (doc.Node == nil) == (doc.Err == nil) {
+			t.Errorf("document %d has Node %v and Err %v, want exactly one", i, doc.Node, doc.Err)
+		}
+		got = append(got, span{start: doc.StartLine, end: doc.EndLine, valid: doc.Err == nil})
+	}
+	return got
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []span
+	}{
+		{
+			name:    "empty",
+			content: "",
+			want:    []span{},
+		},
+		{
+			name:    "single document without markers",
+			content: "kind: Service\nmetadata:\n  name: web\n",
+			want:    []span{{start: 1, end: 3, valid: true}},
+		},
+		{
+			name:    "start markers",
+			content: "---\nkind: Service\n---\nkind: Deployment\n",
+			want:    []span{{start: 1, end: 2, valid: true}, {start: 3, end: 4, valid: true}},
+		},
+		{
+			name:    "end markers",
+			content: "kind: Service\n...\nkind: Deployment\n...\n",
+			want:    []span{{start: 1, end: 2, valid: true}, {start: 3, end: 4, valid: true}},
+		},
+		{
+			name:    "blank and comment-only documents",
+			content: "# header\n---\n\n---\n# nothing here\n---\nkind: Service\n---\n",
+			want:    []span{{start: 6, end: 7, valid: true}},
+		},
+		{
+			name:    "marker with trailing comment",
+			content: "kind: Service\n--- # next\nkind: Deployment\n",
+			want:    []span{{start: 1, end: 1, valid: true}, {start: 2, end: 3, valid: true}},
+		},
+		{
+			name:    "markers inside block scalars",
+			content: "data:\n  script: |\n    echo ---\n    ---\n    ...\n",
+			want:    []span{{start: 1, end: 5, valid: true}},
+		},
+		{
+			name:    "longer rulers",
+			content: "----\n---\n....\n",
+			want:    []span{{start: 1, end: 1, valid: true}, {start: 2, end: 3, valid: true}},
+		},
+		{
+			name:    "syntax error in one document",
+			content: "kind: Service\n---\nkind: [Deployment\n---\nkind: ConfigMap\n",
+			want: []span{
+				{start: 1, end: 1, valid: true},
+				{start: 2, end: 3, valid: false},
+				{start: 4, end: 5, valid: true},
+			},
+		},
+		{
+			name:    "windows line endings",
+			content: "kind: Service\r\n---\r\nkind: Deployment\r\n",
+			want:    []span{{start: 1, end: 1, valid: true}, {start: 2, end: 3, valid: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := spans(t, yamldoc.Split([]byte(tt.content)))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Split() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Split() document %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitNodeLines(t *testing.T) {
+	content := "kind: Service\n---\n# comment\nkind: Deployment\nmetadata:\n  name: web\n"
+
+	docs := yamldoc.Split([]byte(content))
+	if len(docs) != 2 {
+		t.Fatalf("Split() returned %d documents, want 2", len(docs))
+	}
+
+	// Node lines are relative to the whole stream, not the document
+	mapping := docs[1].Node.Content[0]
+	tests := []struct {
+		key  string
+		line int
+	}{
+		{key: "kind", line: 4},
+		{key: "metadata", line: 5},
+	}
+	for _, tt := range tests {
+		found := false
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == tt.key {
+				found = true
+				if got := mapping.Content[i].Line; got != tt.line {
+					t.Errorf("%s is on line %d, want %d", tt.key, got, tt.line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("%s not found in the second document", tt.key)
+		}
+	}
+}